@@ -1,6 +1,6 @@
 module github.com/pirsch-analytics/pirsch-go-sdk/v2
 
-go 1.21
+go 1.23
 
 require (
 	github.com/emvi/null v1.3.1
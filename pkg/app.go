@@ -0,0 +1,288 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAppURLScheme         = "app"
+	defaultAppKeepAliveInterval = time.Minute * 5
+)
+
+// AppTrackerConfig is used to configure the AppTracker.
+type AppTrackerConfig struct {
+	// Name is the app name. It's required and used for the user agent and URL.
+	Name string
+
+	// Version is the optional app version added to the user agent.
+	Version string
+
+	// URL is the base URL screens are tracked for, like https://app.example.com. app://<name> by default.
+	URL string
+
+	// Locale is the locale of the user, like de-DE or de_DE.UTF-8.
+	// It's read from the LC_ALL, LC_MESSAGES, and LANG environment variables if not set.
+	Locale string
+
+	// ScreenWidth is the optional screen width.
+	ScreenWidth int
+
+	// ScreenHeight is the optional screen height.
+	ScreenHeight int
+
+	// VisitorID is a stable identifier for the installation, like a random ID stored in the config directory of the app.
+	// Pirsch identifies visitors by their IP address, which the app doesn't know,
+	// so the ID is hashed into a unique local IPv6 address instead. A random ID is used if not set,
+	// so each run of the app counts as a new visitor. Note that the location of visitors cannot be tracked.
+	VisitorID string
+
+	// IP is the optional IP address of the user. It overrides the VisitorID.
+	IP string
+
+	// KeepAliveInterval is the interval in which sessions are kept alive while the app is in the foreground. 5 minutes by default.
+	KeepAliveInterval time.Duration
+
+	// OnError is called if a session keep-alive could not be sent. Errors are logged using the client logger if not set.
+	OnError func(err error)
+}
+
+// AppTracker tracks screens and events for native apps and command line tools, which don't have an http.Request.
+// The visitor is built from the app metadata: the app name and version are turned into a user agent,
+// the operating system is read from runtime.GOOS, and screens are tracked as URLs using a synthetic app:// URL.
+// The BotFilter of the Client is not applied.
+type AppTracker struct {
+	client            *Client
+	baseURL           string
+	visitor           VisitorContext
+	keepAliveInterval time.Duration
+	onError           func(error)
+	screen            string
+	cancel            context.CancelFunc
+	wg                sync.WaitGroup
+	m                 sync.Mutex
+}
+
+// NewAppTracker creates a new AppTracker for given Client and configuration.
+func NewAppTracker(client *Client, config *AppTrackerConfig) (*AppTracker, error) {
+	if config == nil || config.Name == "" {
+		return nil, errors.New("app name required")
+	}
+
+	if config.URL == "" {
+		config.URL = fmt.Sprintf("%s://%s", defaultAppURLScheme, strings.ToLower(strings.Join(strings.Fields(config.Name), "-")))
+	}
+
+	if config.Locale == "" {
+		config.Locale = getEnvLocale()
+	}
+
+	if config.KeepAliveInterval <= 0 {
+		config.KeepAliveInterval = defaultAppKeepAliveInterval
+	}
+
+	if config.IP == "" {
+		if config.VisitorID == "" {
+			id := make([]byte, 16)
+
+			if _, err := rand.Read(id); err != nil {
+				return nil, err
+			}
+
+			config.VisitorID = string(id)
+		}
+
+		config.IP = visitorIDToIP(config.VisitorID)
+	}
+
+	platform := appPlatform(runtime.GOOS)
+	return &AppTracker{
+		client:  client,
+		baseURL: strings.TrimSuffix(config.URL, "/"),
+		visitor: VisitorContext{
+			URL:             config.URL,
+			IP:              config.IP,
+			UserAgent:       appUserAgent(config.Name, config.Version, platform),
+			AcceptLanguage:  toAcceptLanguage(config.Locale),
+			SecCHUAPlatform: `"` + platform + `"`,
+			ScreenWidth:     config.ScreenWidth,
+			ScreenHeight:    config.ScreenHeight,
+		},
+		keepAliveInterval: config.KeepAliveInterval,
+		onError:           config.OnError,
+	}, nil
+}
+
+// Screen sends a page view for given screen path (like /settings/account) and optional title and tags.
+// The screen is remembered and used for events and session keep-alives.
+func (tracker *AppTracker) Screen(ctx context.Context, path, title string, tags map[string]string) error {
+	tracker.m.Lock()
+	tracker.screen = tracker.screenURL(path)
+	hit := tracker.visitor.pageView(tracker.screen)
+	tracker.m.Unlock()
+	hit.Title = title
+	hit.Tags = tags
+	return tracker.client.sendPageView(ctx, hit, time.Time{})
+}
+
+// Event sends an event for the current screen, like the usage of a feature.
+func (tracker *AppTracker) Event(ctx context.Context, name string, durationSeconds int, meta map[string]string) error {
+	if name == "" {
+		return errors.New("event name required")
+	}
+
+	return tracker.client.sendEvent(ctx, Event{
+		PageView:        tracker.pageView(),
+		Name:            name,
+		DurationSeconds: durationSeconds,
+		Metadata:        meta,
+	}, time.Time{})
+}
+
+// Foreground starts sending session keep-alives in the background, so that the session doesn't time out while the app is in use.
+// Call it when the app starts or is brought to the foreground.
+func (tracker *AppTracker) Foreground() {
+	tracker.m.Lock()
+	defer tracker.m.Unlock()
+
+	if tracker.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.cancel = cancel
+	tracker.wg.Add(1)
+	go tracker.keepAlive(ctx)
+}
+
+// Background stops sending session keep-alives. Call it when the app is moved to the background or before it exits.
+func (tracker *AppTracker) Background() {
+	tracker.m.Lock()
+
+	if tracker.cancel == nil {
+		tracker.m.Unlock()
+		return
+	}
+
+	tracker.cancel()
+	tracker.cancel = nil
+	tracker.m.Unlock()
+	tracker.wg.Wait()
+}
+
+// Visitor returns the VisitorContext of the app.
+func (tracker *AppTracker) Visitor() VisitorContext {
+	return tracker.visitor
+}
+
+func (tracker *AppTracker) keepAlive(ctx context.Context) {
+	defer tracker.wg.Done()
+	ticker := time.NewTicker(tracker.keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := tracker.client.sendSession(ctx, tracker.pageView()); err != nil && ctx.Err() == nil {
+				if tracker.onError != nil {
+					tracker.onError(err)
+				} else if tracker.client.logger != nil {
+					tracker.client.logger.Error("error sending session keep-alive", "err", err)
+				}
+			}
+		}
+	}
+}
+
+func (tracker *AppTracker) pageView() PageView {
+	tracker.m.Lock()
+	defer tracker.m.Unlock()
+	return tracker.visitor.pageView(tracker.screen)
+}
+
+func (tracker *AppTracker) screenURL(path string) string {
+	if path == "" {
+		return tracker.baseURL + "/"
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return tracker.baseURL + path
+}
+
+func appUserAgent(name, version, platform string) string {
+	product := strings.Join(strings.Fields(name), "")
+
+	if version != "" {
+		product += "/" + version
+	}
+
+	return fmt.Sprintf("%s (%s; %s)", product, platform, runtime.GOARCH)
+}
+
+func appPlatform(goos string) string {
+	switch goos {
+	case "windows":
+		return "Windows"
+	case "darwin":
+		return "macOS"
+	case "linux":
+		return "Linux"
+	case "android":
+		return "Android"
+	case "ios":
+		return "iOS"
+	case "freebsd":
+		return "FreeBSD"
+	case "openbsd":
+		return "OpenBSD"
+	default:
+		return goos
+	}
+}
+
+// getEnvLocale returns the locale from the environment, like de_DE.UTF-8.
+func getEnvLocale() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(env); locale != "" {
+			return locale
+		}
+	}
+
+	return ""
+}
+
+// toAcceptLanguage converts a POSIX locale like de_DE.UTF-8 to a language tag like de-DE.
+func toAcceptLanguage(locale string) string {
+	if i := strings.IndexAny(locale, ".@"); i > -1 {
+		locale = locale[:i]
+	}
+
+	if locale == "C" || locale == "POSIX" {
+		return ""
+	}
+
+	return strings.ReplaceAll(locale, "_", "-")
+}
+
+// visitorIDToIP hashes the visitor ID into an address of the unique local IPv6 range fd00::/8.
+func visitorIDToIP(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	var ip [16]byte
+	copy(ip[:], hash[:16])
+	ip[0] = 0xfd
+	return netip.AddrFrom16(ip).String()
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppTracker(t *testing.T) {
+	requests := make(chan string, 100)
+	hits := make(chan Event, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hit Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&hit))
+		requests <- r.URL.Path
+		hits <- hit
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	_, err := NewAppTracker(client, nil)
+	assert.Error(t, err)
+	tracker, err := NewAppTracker(client, &AppTrackerConfig{
+		Name:              "Monitor Pro",
+		Version:           "1.2.3",
+		Locale:            "de_DE.UTF-8",
+		ScreenWidth:       1920,
+		ScreenHeight:      1080,
+		VisitorID:         "installation",
+		KeepAliveInterval: time.Millisecond * 20,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, tracker.Screen(context.Background(), "settings/account", "Account", nil))
+	assert.Equal(t, hitEndpoint, <-requests)
+	hit := <-hits
+	assert.Equal(t, "app://monitor-pro/settings/account", hit.URL)
+	assert.Equal(t, "Account", hit.Title)
+	assert.Equal(t, "MonitorPro/1.2.3 ("+appPlatform(runtime.GOOS)+"; "+runtime.GOARCH+")", hit.UserAgent)
+	assert.Equal(t, `"`+appPlatform(runtime.GOOS)+`"`, hit.SecCHUAPlatform)
+	assert.Equal(t, "de-DE", hit.AcceptLanguage)
+	assert.Equal(t, 1920, hit.ScreenWidth)
+	assert.True(t, strings.HasPrefix(hit.IP, "fd"))
+	assert.NoError(t, tracker.Event(context.Background(), "Export", 3, map[string]string{"format": "csv"}))
+	assert.Equal(t, eventEndpoint, <-requests)
+	event := <-hits
+	assert.Equal(t, "Export", event.Name)
+	assert.Equal(t, "app://monitor-pro/settings/account", event.URL)
+	assert.Equal(t, hit.IP, event.IP)
+	tracker.Foreground()
+	tracker.Foreground()
+	assert.Equal(t, sessionEndpoint, <-requests)
+	assert.Equal(t, "app://monitor-pro/settings/account", (<-hits).URL)
+	tracker.Background()
+	tracker.Background()
+	time.Sleep(time.Millisecond * 20)
+
+	for len(requests) > 0 {
+		<-requests
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	assert.Empty(t, requests)
+	other, err := NewAppTracker(client, &AppTrackerConfig{Name: "App", VisitorID: "installation"})
+	assert.NoError(t, err)
+	assert.Equal(t, hit.IP, other.Visitor().IP)
+	assert.Equal(t, "app://app", other.Visitor().URL)
+}
+
+func TestToAcceptLanguage(t *testing.T) {
+	assert.Equal(t, "de-DE", toAcceptLanguage("de_DE.UTF-8"))
+	assert.Equal(t, "en-US", toAcceptLanguage("en-US"))
+	assert.Equal(t, "sr-RS", toAcceptLanguage("sr_RS@latin"))
+	assert.Empty(t, toAcceptLanguage("C"))
+	assert.Empty(t, toAcceptLanguage(""))
+}
@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultMinUserAgentLength = 10
+
+// ErrFilteredBot is returned if a page view or event has not been sent because it was sent by a bot.
+var ErrFilteredBot = errors.New("filtered bot")
+
+//go:embed bots.txt
+var defaultBotPatterns string
+
+// BotFilterConfig is used to configure the BotFilter.
+type BotFilterConfig struct {
+	// Patterns is a list of additional case-insensitive user agent substrings to filter.
+	Patterns []string
+
+	// DisableDefaultPatterns disables the embedded list of user agent patterns.
+	DisableDefaultPatterns bool
+
+	// MinUserAgentLength is the minimum length of the user agent. Shorter user agents, including empty ones, are filtered.
+	// 10 by default. Set to a negative value to disable this check.
+	MinUserAgentLength int
+
+	// IPRanges is a list of networks in CIDR notation or single addresses to filter.
+	IPRanges []string
+}
+
+// BotFilter filters page views and events sent by bots, crawlers, uptime monitors, and HTTP libraries before they are sent to Pirsch.
+type BotFilter struct {
+	patterns           []string
+	minUserAgentLength int
+	ipRanges           []netip.Prefix
+	filtered           atomic.Uint64
+	m                  sync.RWMutex
+}
+
+// NewBotFilter creates a new BotFilter for given optional configuration.
+func NewBotFilter(config *BotFilterConfig) (*BotFilter, error) {
+	if config == nil {
+		config = new(BotFilterConfig)
+	}
+
+	if config.MinUserAgentLength == 0 {
+		config.MinUserAgentLength = defaultMinUserAgentLength
+	}
+
+	ipRanges := make([]netip.Prefix, 0, len(config.IPRanges))
+
+	for _, ipRange := range config.IPRanges {
+		var prefix netip.Prefix
+		var err error
+
+		if strings.Contains(ipRange, "/") {
+			prefix, err = netip.ParsePrefix(ipRange)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(ipRange)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		ipRanges = append(ipRanges, prefix.Masked())
+	}
+
+	filter := &BotFilter{
+		minUserAgentLength: config.MinUserAgentLength,
+		ipRanges:           ipRanges,
+	}
+	patterns := make([]string, 0)
+
+	if !config.DisableDefaultPatterns {
+		defaultPatterns, err := readBotPatterns(strings.NewReader(defaultBotPatterns))
+
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, defaultPatterns...)
+	}
+
+	filter.SetPatterns(append(patterns, config.Patterns...))
+	return filter, nil
+}
+
+// SetPatterns replaces the user agent patterns.
+func (filter *BotFilter) SetPatterns(patterns []string) {
+	lower := make([]string, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+		if pattern != "" {
+			lower = append(lower, pattern)
+		}
+	}
+
+	filter.m.Lock()
+	defer filter.m.Unlock()
+	filter.patterns = lower
+}
+
+// LoadPatterns replaces the user agent patterns with the ones read from given reader.
+// The reader must provide one pattern per line, lines starting with # are ignored.
+func (filter *BotFilter) LoadPatterns(r io.Reader) error {
+	patterns, err := readBotPatterns(r)
+
+	if err != nil {
+		return err
+	}
+
+	filter.SetPatterns(patterns)
+	return nil
+}
+
+// IsBot returns whether given IP address and user agent belong to a bot.
+func (filter *BotFilter) IsBot(ip, userAgent string) bool {
+	userAgent = strings.TrimSpace(userAgent)
+
+	if filter.minUserAgentLength > 0 && len(userAgent) < filter.minUserAgentLength {
+		return true
+	}
+
+	if len(filter.ipRanges) > 0 {
+		if addr := parseIP(ip); addr.IsValid() {
+			for _, prefix := range filter.ipRanges {
+				if prefix.Contains(addr) {
+					return true
+				}
+			}
+		}
+	}
+
+	userAgent = strings.ToLower(userAgent)
+	filter.m.RLock()
+	defer filter.m.RUnlock()
+
+	for _, pattern := range filter.patterns {
+		if strings.Contains(userAgent, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filtered returns the number of page views and events that have been filtered.
+func (filter *BotFilter) Filtered() uint64 {
+	return filter.filtered.Load()
+}
+
+// filter returns ErrFilteredBot and counts the page view if it was sent by a bot.
+func (filter *BotFilter) filter(pageView *PageView) error {
+	if filter.IsBot(pageView.IP, pageView.UserAgent) {
+		filter.filtered.Add(1)
+		return ErrFilteredBot
+	}
+
+	return nil
+}
+
+func readBotPatterns(r io.Reader) ([]string, error) {
+	patterns := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
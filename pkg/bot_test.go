@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBotFilter(t *testing.T) {
+	filter, err := NewBotFilter(&BotFilterConfig{
+		Patterns: []string{"CustomAgent"},
+		IPRanges: []string{"192.0.2.0/24", "2001:db8::1"},
+	})
+	assert.NoError(t, err)
+	browser := "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"
+	input := []struct {
+		ip        string
+		userAgent string
+		bot       bool
+	}{
+		{"198.51.100.1", browser, false},
+		{"198.51.100.1", "", true},
+		{"198.51.100.1", "Mozilla", true},
+		{"198.51.100.1", "curl/8.4.0", true},
+		{"198.51.100.1", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"198.51.100.1", "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", true},
+		{"198.51.100.1", "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", true},
+		{"198.51.100.1", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"198.51.100.1", "TelegramBot (like TwitterBot)", true},
+		{"198.51.100.1", "Mozilla/5.0 (Linux; Android 12; CUBOT_X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", false},
+		{"198.51.100.1", "Mozilla/5.0 (Linux; Android 11; CUBOT NOTE 20 Build/RP1A.200720.011) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", false},
+		{"198.51.100.1", "kube-probe/1.29", true},
+		{"198.51.100.1", "Go-http-client/2.0", true},
+		{"198.51.100.1", "Mozilla/5.0 customagent/1.0", true},
+		{"192.0.2.42", browser, true},
+		{"2001:db8::1", browser, true},
+		{"2001:db8::2", browser, false},
+	}
+
+	for _, in := range input {
+		assert.Equal(t, in.bot, filter.IsBot(in.ip, in.userAgent), in.userAgent)
+	}
+
+	assert.NoError(t, filter.LoadPatterns(strings.NewReader("# comment\n\nfirefox\n")))
+	assert.True(t, filter.IsBot("198.51.100.1", browser))
+	assert.False(t, filter.IsBot("198.51.100.1", "curl/8.4.0"))
+	_, err = NewBotFilter(&BotFilterConfig{IPRanges: []string{"invalid"}})
+	assert.Error(t, err)
+}
+
+func TestClientBotFilter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+	filter, err := NewBotFilter(nil)
+	assert.NoError(t, err)
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL:   server.URL,
+		BotFilter: filter,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.Header.Set("User-Agent", "curl/8.4.0")
+	assert.ErrorIs(t, client.PageView(req, nil), ErrFilteredBot)
+	assert.ErrorIs(t, client.Event("event", 0, nil, req, nil), ErrFilteredBot)
+	assert.NoError(t, client.PageView(req, &PageViewOptions{
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	}))
+	assert.Equal(t, uint64(2), filter.Filtered())
+	assert.Equal(t, int32(1), requests.Load())
+}
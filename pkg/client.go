@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,11 +21,15 @@ const (
 	defaultBaseURL        = "https://api.pirsch.io"
 	defaultTimeout        = time.Second * 5
 	defaultRequestRetries = 5
+	tokenRefreshMargin    = time.Minute
 
 	authenticationEndpoint  = "/api/v1/token"
 	hitEndpoint             = "/api/v1/hit"
+	hitBatchEndpoint        = "/api/v1/hit/batch"
 	eventEndpoint           = "/api/v1/event"
+	eventBatchEndpoint      = "/api/v1/event/batch"
 	sessionEndpoint         = "/api/v1/session"
+	sessionBatchEndpoint    = "/api/v1/session/batch"
 	domainEndpoint          = "/api/v1/domain"
 	sessionDurationEndpoint = "/api/v1/statistics/duration/session"
 	timeOnPageEndpoint      = "/api/v1/statistics/duration/page"
@@ -73,15 +79,34 @@ var referrerQueryParams = []string{
 
 // Client is used to access the Pirsch API.
 type Client struct {
-	baseURL        string
-	logger         *slog.Logger
-	clientID       string
-	clientSecret   string
-	accessToken    string
-	expiresAt      time.Time
-	timeout        time.Duration
-	requestRetries int
-	m              sync.RWMutex
+	baseURL           string
+	logger            *slog.Logger
+	tokenSource       TokenSource
+	accessToken       string
+	expiresAt         time.Time
+	refresh           *tokenRefresh
+	httpClient        *http.Client
+	retryPolicy       RetryPolicy
+	spool             *Spool
+	ipResolver        IPResolver
+	botFilter         *BotFilter
+	urlNormalizer     *URLNormalizer
+	speculativeLoads  SpeculativeLoadPolicy
+	onSpeculativeLoad func(*http.Request, BatchPageView)
+	partialRequests   PartialRequestPolicy
+	trackers          map[*AsyncTracker]struct{}
+	defaultTracker    *AsyncTracker
+	defaultConfig     *AsyncTrackerConfig
+	defaultOnce       sync.Once
+	closed            atomic.Bool
+	lifecycleM        sync.Mutex
+	m                 sync.RWMutex
+}
+
+// tokenRefresh is an access token refresh in flight shared by all requests waiting for it.
+type tokenRefresh struct {
+	done chan struct{}
+	err  error
 }
 
 // ClientConfig is used to configure the Client.
@@ -91,11 +116,56 @@ type ClientConfig struct {
 	BaseURL string
 
 	// Timeout is the timeout for HTTP requests. 5 seconds by default.
+	// The timeout is ignored if HTTPClient is set.
 	Timeout time.Duration
 
+	// HTTPClient is an optional http.Client used for all requests, including token refreshes.
+	// It can be used to set a custom transport for connection pooling, proxies, certificates, or testing.
+	HTTPClient *http.Client
+
 	// RequestRetries sets the maximum number of requests before an error is returned. 5 retries by default.
+	// The number of retries is ignored if RetryPolicy is set.
 	RequestRetries int
 
+	// RetryPolicy is an optional policy deciding whether and when failed requests are retried.
+	// A DefaultRetryPolicy using RequestRetries is used by default.
+	RetryPolicy RetryPolicy
+
+	// TokenSource is an optional source for access tokens.
+	// By default, tokens are requested using the client ID and secret, or the client secret is used as a single access token
+	// if no client ID is set. Use a FileTokenCache to reuse tokens across processes.
+	TokenSource TokenSource
+
+	// Spool is an optional Spool to store page views, events, and sessions that could not be sent because the API is unavailable.
+	// Spooled data is replayed periodically and the methods sending it return no error once it has been spooled.
+	// Close the Spool to stop replaying.
+	Spool *Spool
+
+	// IPResolver is an optional resolver extracting the visitor IP address from requests.
+	// The http.Request.RemoteAddr is used by default. Use a ProxyIPResolver when running behind proxies or load balancers.
+	IPResolver IPResolver
+
+	// BotFilter is an optional filter for page views and events sent by bots.
+	// Filtered page views and events are not sent and ErrFilteredBot is returned instead.
+	BotFilter *BotFilter
+
+	// URLNormalizer is an optional URLNormalizer rewriting the page URL of page views, events, and sessions.
+	URLNormalizer *URLNormalizer
+
+	// SpeculativeLoads decides how page views for speculative loads (prefetch or prerender) are handled.
+	// They are skipped by default.
+	SpeculativeLoads SpeculativeLoadPolicy
+
+	// OnSpeculativeLoad is called with the page view for speculative loads if SpeculativeLoads is set to SpeculativeLoadDefer.
+	OnSpeculativeLoad func(r *http.Request, view BatchPageView)
+
+	// PartialRequests decides how page views for partial requests (HTMX or Turbo Frames) are handled.
+	// They are skipped by default.
+	PartialRequests PartialRequestPolicy
+
+	// DefaultTracker is an optional configuration for the AsyncTracker returned by Client.DefaultTracker.
+	DefaultTracker *AsyncTrackerConfig
+
 	// Logger is an optional logger for debugging.
 	Logger slog.Handler
 }
@@ -146,76 +216,272 @@ func NewClient(clientID, clientSecret string, config *ClientConfig) *Client {
 		config.Logger = slog.NewTextHandler(os.Stderr, nil)
 	}
 
-	c := &Client{
-		baseURL:        config.BaseURL,
-		logger:         slog.New(config.Logger),
-		clientID:       clientID,
-		clientSecret:   clientSecret,
-		timeout:        config.Timeout,
-		requestRetries: config.RequestRetries,
+	if config.RetryPolicy == nil {
+		config.RetryPolicy = &DefaultRetryPolicy{
+			MaxRetries: config.RequestRetries,
+		}
+	}
+
+	if config.IPResolver == nil {
+		config.IPResolver = new(RemoteAddrIPResolver)
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: config.Timeout,
+		}
 	}
 
-	// single access tokens do not require to query an access token using oAuth
-	if clientID == "" {
-		c.accessToken = clientSecret
+	// the default token source is kept local, so that the config can be reused for other clients
+	tokenSource := config.TokenSource
+
+	if tokenSource == nil {
+		// single access tokens do not require to query an access token using oAuth
+		if clientID == "" {
+			tokenSource = &StaticTokenSource{
+				AccessToken: clientSecret,
+			}
+		} else {
+			tokenSource = &ClientCredentialsTokenSource{
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				BaseURL:      config.BaseURL,
+				HTTPClient:   config.HTTPClient,
+			}
+		}
+	}
+
+	c := &Client{
+		baseURL:           config.BaseURL,
+		logger:            slog.New(config.Logger),
+		tokenSource:       tokenSource,
+		httpClient:        config.HTTPClient,
+		retryPolicy:       config.RetryPolicy,
+		spool:             config.Spool,
+		ipResolver:        config.IPResolver,
+		botFilter:         config.BotFilter,
+		urlNormalizer:     config.URLNormalizer,
+		speculativeLoads:  config.SpeculativeLoads,
+		onSpeculativeLoad: config.OnSpeculativeLoad,
+		partialRequests:   config.PartialRequests,
+		trackers:          make(map[*AsyncTracker]struct{}),
+		defaultConfig:     config.DefaultTracker,
+	}
+
+	if c.spool != nil {
+		go c.replaySpool()
 	}
 
 	return c
 }
 
+// Flush sends all data queued by AsyncTrackers created for this client and replays the spool.
+// It returns once the data has been sent or the context is canceled.
+func (client *Client) Flush(ctx context.Context) error {
+	for _, tracker := range client.getTrackers() {
+		if err := tracker.Flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := client.ReplaySpool(ctx); err != nil && !errors.Is(err, ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// DefaultTracker returns the AsyncTracker owned by the client, which is created on first use.
+// It is used by the middleware and handler packages unless they are configured to use another AsyncTracker,
+// so that the data tracked by them is sent in the background and covered by Close.
+// If it is created after the client has been closed, the AsyncTracker is closed as well and rejects all data.
+func (client *Client) DefaultTracker() *AsyncTracker {
+	client.defaultOnce.Do(func() {
+		client.defaultTracker = NewAsyncTracker(client, client.defaultConfig)
+	})
+	return client.defaultTracker
+}
+
+// Close shuts down the client. New page views, events, and sessions are rejected with ErrClosed.
+// All AsyncTrackers created for this client, including the DefaultTracker, are closed and the data queued until then is sent.
+// When Close returns without an error, all data submitted to an AsyncTracker before has either been sent to Pirsch or written to the spool.
+// If data could not be sent, because the API failed or the context is canceled before, a *DroppedError reporting the number of dropped items is returned.
+// Page views, events, and sessions sent synchronously (e.g. using PageView) are not waited for.
+// The spool is closed and keeps its data on disk to be replayed once it is opened again.
+func (client *Client) Close(ctx context.Context) error {
+	if client.closed.Swap(true) {
+		return nil
+	}
+
+	dropped := 0
+	var droppedErr, closeErr error
+
+	for _, tracker := range client.getTrackers() {
+		if err := tracker.Close(ctx); err != nil {
+			var trackerErr *DroppedError
+
+			if errors.As(err, &trackerErr) {
+				dropped += trackerErr.Dropped
+
+				if droppedErr == nil {
+					droppedErr = trackerErr.Err
+				}
+			}
+
+			closeErr = err
+		}
+	}
+
+	if client.spool != nil {
+		if err := client.spool.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+
+	client.httpClient.CloseIdleConnections()
+
+	if dropped > 0 {
+		return &DroppedError{
+			Dropped: dropped,
+			Err:     droppedErr,
+		}
+	}
+
+	return closeErr
+}
+
 // PageView sends a page hit to Pirsch for given http.Request and options.
 func (client *Client) PageView(r *http.Request, options *PageViewOptions) error {
+	return client.PageViewContext(context.Background(), r, options)
+}
+
+// PageViewContext is the same as PageView, but accepts a context.
+func (client *Client) PageViewContext(ctx context.Context, r *http.Request, options *PageViewOptions) error {
 	if options == nil {
 		options = new(PageViewOptions)
 	}
 
 	hit := client.getPageViewData(r, options)
-	return client.performPost(client.baseURL+hitEndpoint, &hit, client.requestRetries)
+
+	if err := client.filterBot(&hit); err != nil {
+		return err
+	}
+
+	if err := client.handleSpeculativeLoad(r, &hit); err != nil {
+		return err
+	}
+
+	if err := client.handlePartialRequest(r); err != nil {
+		return err
+	}
+
+	return client.performTrackingPost(ctx, client.baseURL+hitEndpoint, &hit, &Batch{
+		PageViews: []BatchPageView{{PageView: hit, Time: time.Now().UTC()}},
+	})
+}
+
+// PageViewBatch sends multiple page hits to Pirsch at once.
+func (client *Client) PageViewBatch(views []BatchPageView) error {
+	return client.PageViewBatchContext(context.Background(), views)
+}
+
+// PageViewBatchContext is the same as PageViewBatch, but accepts a context.
+func (client *Client) PageViewBatchContext(ctx context.Context, views []BatchPageView) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	return client.performTrackingPost(ctx, client.baseURL+hitBatchEndpoint, views, &Batch{PageViews: views})
 }
 
 // Event sends an event to Pirsch for given http.Request and options.
 func (client *Client) Event(name string, durationSeconds int, meta map[string]string, r *http.Request, options *PageViewOptions) error {
+	return client.EventContext(context.Background(), name, durationSeconds, meta, r, options)
+}
+
+// EventContext is the same as Event, but accepts a context.
+func (client *Client) EventContext(ctx context.Context, name string, durationSeconds int, meta map[string]string, r *http.Request, options *PageViewOptions) error {
 	if options == nil {
 		options = new(PageViewOptions)
 	}
 
-	return client.performPost(client.baseURL+eventEndpoint, &Event{
-		Name:            name,
-		DurationSeconds: durationSeconds,
-		Metadata:        meta,
-		PageView:        client.getPageViewData(r, options),
-	}, client.requestRetries)
+	event := client.getEventData(name, durationSeconds, meta, r, options)
+
+	if err := client.filterBot(&event.PageView); err != nil {
+		return err
+	}
+
+	return client.performTrackingPost(ctx, client.baseURL+eventEndpoint, &event, &Batch{
+		Events: []BatchEvent{{Event: event, Time: time.Now().UTC()}},
+	})
 }
 
 // Session keeps a session alive for the given http.Request and options.
 func (client *Client) Session(r *http.Request, options *PageViewOptions) error {
+	return client.SessionContext(context.Background(), r, options)
+}
+
+// SessionContext is the same as Session, but accepts a context.
+func (client *Client) SessionContext(ctx context.Context, r *http.Request, options *PageViewOptions) error {
 	if options == nil {
 		options = new(PageViewOptions)
 	}
 
-	return client.performPost(client.baseURL+sessionEndpoint, &PageView{
-		URL:                    r.URL.String(),
-		IP:                     client.selectField(options.IP, r.RemoteAddr),
-		UserAgent:              client.selectField(options.UserAgent, r.Header.Get("User-Agent")),
-		SecCHUA:                client.selectField(options.SecCHUA, r.Header.Get("Sec-CH-UA")),
-		SecCHUAMobile:          client.selectField(options.SecCHUAMobile, r.Header.Get("Sec-CH-UA-Mobile")),
-		SecCHUAPlatform:        client.selectField(options.SecCHUAPlatform, r.Header.Get("Sec-CH-UA-Platform")),
-		SecCHUAPlatformVersion: client.selectField(options.SecCHUAPlatformVersion, r.Header.Get("Sec-CH-UA-Platform-Version")),
-		SecCHWidth:             client.selectField(options.SecCHWidth, r.Header.Get("Sec-CH-Width")),
-		SecCHViewportWidth:     client.selectField(options.SecCHViewportWidth, r.Header.Get("Sec-CH-Viewport-Width")),
-	}, client.requestRetries)
+	session := client.getSessionData(r, options)
+	return client.performTrackingPost(ctx, client.baseURL+sessionEndpoint, &session, &Batch{
+		Sessions: []BatchPageView{{PageView: session, Time: time.Now().UTC()}},
+	})
+}
+
+// EventBatch sends multiple events to Pirsch at once.
+func (client *Client) EventBatch(events []BatchEvent) error {
+	return client.EventBatchContext(context.Background(), events)
+}
+
+// EventBatchContext is the same as EventBatch, but accepts a context.
+func (client *Client) EventBatchContext(ctx context.Context, events []BatchEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return client.performTrackingPost(ctx, client.baseURL+eventBatchEndpoint, events, &Batch{Events: events})
+}
+
+// SessionBatch keeps multiple sessions alive at once.
+func (client *Client) SessionBatch(sessions []BatchPageView) error {
+	return client.SessionBatchContext(context.Background(), sessions)
+}
+
+// SessionBatchContext is the same as SessionBatch, but accepts a context.
+func (client *Client) SessionBatchContext(ctx context.Context, sessions []BatchPageView) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	return client.performTrackingPost(ctx, client.baseURL+sessionBatchEndpoint, sessions, &Batch{Sessions: sessions})
+}
+
+// ReferrerFromRequest returns the referrer for given request read from the Referer header,
+// or the ref, referer, referrer, source, or utm_source query parameters if the header is not set.
+func (client *Client) ReferrerFromRequest(r *http.Request) string {
+	return client.getReferrerFromHeaderOrQuery(r)
 }
 
 // Domain returns the domain for this client.
 func (client *Client) Domain() (*Domain, error) {
+	return client.DomainContext(context.Background())
+}
+
+// DomainContext is the same as Domain, but accepts a context.
+func (client *Client) DomainContext(ctx context.Context) (*Domain, error) {
 	domains := make([]Domain, 0, 1)
 
-	if err := client.performGet(client.baseURL+domainEndpoint, client.requestRetries, &domains); err != nil {
+	if err := client.performGet(ctx, client.baseURL+domainEndpoint, &domains); err != nil {
 		return nil, err
 	}
 
 	if len(domains) != 1 {
-		return nil, errors.New("domain not found")
+		return nil, ErrDomainNotFound
 	}
 
 	return &domains[0], nil
@@ -223,9 +489,14 @@ func (client *Client) Domain() (*Domain, error) {
 
 // SessionDuration returns the session duration grouped by day.
 func (client *Client) SessionDuration(filter *Filter) ([]TimeSpentStats, error) {
+	return client.SessionDurationContext(context.Background(), filter)
+}
+
+// SessionDurationContext is the same as SessionDuration, but accepts a context.
+func (client *Client) SessionDurationContext(ctx context.Context, filter *Filter) ([]TimeSpentStats, error) {
 	stats := make([]TimeSpentStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(sessionDurationEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, sessionDurationEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -234,9 +505,14 @@ func (client *Client) SessionDuration(filter *Filter) ([]TimeSpentStats, error)
 
 // TimeOnPage returns the time spent on pages.
 func (client *Client) TimeOnPage(filter *Filter) ([]TimeSpentStats, error) {
+	return client.TimeOnPageContext(context.Background(), filter)
+}
+
+// TimeOnPageContext is the same as TimeOnPage, but accepts a context.
+func (client *Client) TimeOnPageContext(ctx context.Context, filter *Filter) ([]TimeSpentStats, error) {
 	stats := make([]TimeSpentStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(timeOnPageEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, timeOnPageEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -245,9 +521,14 @@ func (client *Client) TimeOnPage(filter *Filter) ([]TimeSpentStats, error) {
 
 // UTMSource returns the utm sources.
 func (client *Client) UTMSource(filter *Filter) ([]UTMSourceStats, error) {
+	return client.UTMSourceContext(context.Background(), filter)
+}
+
+// UTMSourceContext is the same as UTMSource, but accepts a context.
+func (client *Client) UTMSourceContext(ctx context.Context, filter *Filter) ([]UTMSourceStats, error) {
 	stats := make([]UTMSourceStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(utmSourceEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, utmSourceEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -256,9 +537,14 @@ func (client *Client) UTMSource(filter *Filter) ([]UTMSourceStats, error) {
 
 // UTMMedium returns the utm medium.
 func (client *Client) UTMMedium(filter *Filter) ([]UTMMediumStats, error) {
+	return client.UTMMediumContext(context.Background(), filter)
+}
+
+// UTMMediumContext is the same as UTMMedium, but accepts a context.
+func (client *Client) UTMMediumContext(ctx context.Context, filter *Filter) ([]UTMMediumStats, error) {
 	stats := make([]UTMMediumStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(utmMediumEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, utmMediumEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -267,9 +553,14 @@ func (client *Client) UTMMedium(filter *Filter) ([]UTMMediumStats, error) {
 
 // UTMCampaign returnst he utm campaigns.
 func (client *Client) UTMCampaign(filter *Filter) ([]UTMCampaignStats, error) {
+	return client.UTMCampaignContext(context.Background(), filter)
+}
+
+// UTMCampaignContext is the same as UTMCampaign, but accepts a context.
+func (client *Client) UTMCampaignContext(ctx context.Context, filter *Filter) ([]UTMCampaignStats, error) {
 	stats := make([]UTMCampaignStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(utmCampaignEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, utmCampaignEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -278,9 +569,14 @@ func (client *Client) UTMCampaign(filter *Filter) ([]UTMCampaignStats, error) {
 
 // UTMContent returns the utm content.
 func (client *Client) UTMContent(filter *Filter) ([]UTMContentStats, error) {
+	return client.UTMContentContext(context.Background(), filter)
+}
+
+// UTMContentContext is the same as UTMContent, but accepts a context.
+func (client *Client) UTMContentContext(ctx context.Context, filter *Filter) ([]UTMContentStats, error) {
 	stats := make([]UTMContentStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(utmContentEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, utmContentEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -289,9 +585,14 @@ func (client *Client) UTMContent(filter *Filter) ([]UTMContentStats, error) {
 
 // UTMTerm returns the utm term.
 func (client *Client) UTMTerm(filter *Filter) ([]UTMTermStats, error) {
+	return client.UTMTermContext(context.Background(), filter)
+}
+
+// UTMTermContext is the same as UTMTerm, but accepts a context.
+func (client *Client) UTMTermContext(ctx context.Context, filter *Filter) ([]UTMTermStats, error) {
 	stats := make([]UTMTermStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(utmTermEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, utmTermEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -300,9 +601,14 @@ func (client *Client) UTMTerm(filter *Filter) ([]UTMTermStats, error) {
 
 // TotalVisitors returns the total visitor statistics.
 func (client *Client) TotalVisitors(filter *Filter) (*TotalVisitorStats, error) {
+	return client.TotalVisitorsContext(context.Background(), filter)
+}
+
+// TotalVisitorsContext is the same as TotalVisitors, but accepts a context.
+func (client *Client) TotalVisitorsContext(ctx context.Context, filter *Filter) (*TotalVisitorStats, error) {
 	stats := new(TotalVisitorStats)
 
-	if err := client.performGet(client.getStatsRequestURL(totalVisitorsEndpoint, filter), client.requestRetries, stats); err != nil {
+	if err := client.performStatsGet(ctx, totalVisitorsEndpoint, filter, stats); err != nil {
 		return nil, err
 	}
 
@@ -311,9 +617,14 @@ func (client *Client) TotalVisitors(filter *Filter) (*TotalVisitorStats, error)
 
 // Visitors returns the visitor statistics grouped by day.
 func (client *Client) Visitors(filter *Filter) ([]VisitorStats, error) {
+	return client.VisitorsContext(context.Background(), filter)
+}
+
+// VisitorsContext is the same as Visitors, but accepts a context.
+func (client *Client) VisitorsContext(ctx context.Context, filter *Filter) ([]VisitorStats, error) {
 	stats := make([]VisitorStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(visitorsEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, visitorsEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -322,9 +633,14 @@ func (client *Client) Visitors(filter *Filter) ([]VisitorStats, error) {
 
 // Pages returns the page statistics grouped by page.
 func (client *Client) Pages(filter *Filter) ([]PageStats, error) {
+	return client.PagesContext(context.Background(), filter)
+}
+
+// PagesContext is the same as Pages, but accepts a context.
+func (client *Client) PagesContext(ctx context.Context, filter *Filter) ([]PageStats, error) {
 	stats := make([]PageStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(pagesEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, pagesEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -333,9 +649,14 @@ func (client *Client) Pages(filter *Filter) ([]PageStats, error) {
 
 // EntryPages returns the entry page statistics grouped by page.
 func (client *Client) EntryPages(filter *Filter) ([]EntryStats, error) {
+	return client.EntryPagesContext(context.Background(), filter)
+}
+
+// EntryPagesContext is the same as EntryPages, but accepts a context.
+func (client *Client) EntryPagesContext(ctx context.Context, filter *Filter) ([]EntryStats, error) {
 	stats := make([]EntryStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(entryPagesEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, entryPagesEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -344,9 +665,14 @@ func (client *Client) EntryPages(filter *Filter) ([]EntryStats, error) {
 
 // ExitPages returns the exit page statistics grouped by page.
 func (client *Client) ExitPages(filter *Filter) ([]ExitStats, error) {
+	return client.ExitPagesContext(context.Background(), filter)
+}
+
+// ExitPagesContext is the same as ExitPages, but accepts a context.
+func (client *Client) ExitPagesContext(ctx context.Context, filter *Filter) ([]ExitStats, error) {
 	stats := make([]ExitStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(exitPagesEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, exitPagesEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -355,9 +681,14 @@ func (client *Client) ExitPages(filter *Filter) ([]ExitStats, error) {
 
 // ConversionGoals returns all conversion goals.
 func (client *Client) ConversionGoals(filter *Filter) ([]ConversionGoal, error) {
+	return client.ConversionGoalsContext(context.Background(), filter)
+}
+
+// ConversionGoalsContext is the same as ConversionGoals, but accepts a context.
+func (client *Client) ConversionGoalsContext(ctx context.Context, filter *Filter) ([]ConversionGoal, error) {
 	stats := make([]ConversionGoal, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(conversionGoalsEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, conversionGoalsEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -366,9 +697,14 @@ func (client *Client) ConversionGoals(filter *Filter) ([]ConversionGoal, error)
 
 // Events returns all events.
 func (client *Client) Events(filter *Filter) ([]EventStats, error) {
+	return client.EventsContext(context.Background(), filter)
+}
+
+// EventsContext is the same as Events, but accepts a context.
+func (client *Client) EventsContext(ctx context.Context, filter *Filter) ([]EventStats, error) {
 	stats := make([]EventStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(eventsEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, eventsEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -377,9 +713,14 @@ func (client *Client) Events(filter *Filter) ([]EventStats, error) {
 
 // EventMetadata returns the metadata values for an event and key.
 func (client *Client) EventMetadata(filter *Filter) ([]EventStats, error) {
+	return client.EventMetadataContext(context.Background(), filter)
+}
+
+// EventMetadataContext is the same as EventMetadata, but accepts a context.
+func (client *Client) EventMetadataContext(ctx context.Context, filter *Filter) ([]EventStats, error) {
 	stats := make([]EventStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(eventMetadataEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, eventMetadataEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -389,9 +730,14 @@ func (client *Client) EventMetadata(filter *Filter) ([]EventStats, error) {
 // EventPages returns the pages an event has been triggered on.
 // The Pages endpoint will return any page that has been visited during a session with a specific event.
 func (client *Client) EventPages(filter *Filter) ([]PageStats, error) {
+	return client.EventPagesContext(context.Background(), filter)
+}
+
+// EventPagesContext is the same as EventPages, but accepts a context.
+func (client *Client) EventPagesContext(ctx context.Context, filter *Filter) ([]PageStats, error) {
 	stats := make([]PageStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(eventPageEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, eventPageEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -400,9 +746,14 @@ func (client *Client) EventPages(filter *Filter) ([]PageStats, error) {
 
 // ListEvents returns a list of all events including metadata.
 func (client *Client) ListEvents(filter *Filter) ([]EventListStats, error) {
+	return client.ListEventsContext(context.Background(), filter)
+}
+
+// ListEventsContext is the same as ListEvents, but accepts a context.
+func (client *Client) ListEventsContext(ctx context.Context, filter *Filter) ([]EventListStats, error) {
 	stats := make([]EventListStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(listEventsEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, listEventsEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -411,9 +762,14 @@ func (client *Client) ListEvents(filter *Filter) ([]EventListStats, error) {
 
 // Growth returns the growth rates for visitors, bounces, ...
 func (client *Client) Growth(filter *Filter) (*Growth, error) {
+	return client.GrowthContext(context.Background(), filter)
+}
+
+// GrowthContext is the same as Growth, but accepts a context.
+func (client *Client) GrowthContext(ctx context.Context, filter *Filter) (*Growth, error) {
 	growth := new(Growth)
 
-	if err := client.performGet(client.getStatsRequestURL(growthRateEndpoint, filter), client.requestRetries, growth); err != nil {
+	if err := client.performStatsGet(ctx, growthRateEndpoint, filter, growth); err != nil {
 		return nil, err
 	}
 
@@ -422,9 +778,14 @@ func (client *Client) Growth(filter *Filter) (*Growth, error) {
 
 // ActiveVisitors returns the active visitors and what pages they're on.
 func (client *Client) ActiveVisitors(filter *Filter) (*ActiveVisitorsData, error) {
+	return client.ActiveVisitorsContext(context.Background(), filter)
+}
+
+// ActiveVisitorsContext is the same as ActiveVisitors, but accepts a context.
+func (client *Client) ActiveVisitorsContext(ctx context.Context, filter *Filter) (*ActiveVisitorsData, error) {
 	active := new(ActiveVisitorsData)
 
-	if err := client.performGet(client.getStatsRequestURL(activeVisitorsEndpoint, filter), client.requestRetries, active); err != nil {
+	if err := client.performStatsGet(ctx, activeVisitorsEndpoint, filter, active); err != nil {
 		return nil, err
 	}
 
@@ -433,9 +794,14 @@ func (client *Client) ActiveVisitors(filter *Filter) (*ActiveVisitorsData, error
 
 // TimeOfDay returns the number of unique visitors grouped by time of day.
 func (client *Client) TimeOfDay(filter *Filter) ([]VisitorHourStats, error) {
+	return client.TimeOfDayContext(context.Background(), filter)
+}
+
+// TimeOfDayContext is the same as TimeOfDay, but accepts a context.
+func (client *Client) TimeOfDayContext(ctx context.Context, filter *Filter) ([]VisitorHourStats, error) {
 	stats := make([]VisitorHourStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(timeOfDayEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, timeOfDayEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -444,9 +810,14 @@ func (client *Client) TimeOfDay(filter *Filter) ([]VisitorHourStats, error) {
 
 // Languages returns language statistics.
 func (client *Client) Languages(filter *Filter) ([]LanguageStats, error) {
+	return client.LanguagesContext(context.Background(), filter)
+}
+
+// LanguagesContext is the same as Languages, but accepts a context.
+func (client *Client) LanguagesContext(ctx context.Context, filter *Filter) ([]LanguageStats, error) {
 	stats := make([]LanguageStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(languageEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, languageEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -455,9 +826,14 @@ func (client *Client) Languages(filter *Filter) ([]LanguageStats, error) {
 
 // Referrer returns referrer statistics.
 func (client *Client) Referrer(filter *Filter) ([]ReferrerStats, error) {
+	return client.ReferrerContext(context.Background(), filter)
+}
+
+// ReferrerContext is the same as Referrer, but accepts a context.
+func (client *Client) ReferrerContext(ctx context.Context, filter *Filter) ([]ReferrerStats, error) {
 	stats := make([]ReferrerStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(referrerEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, referrerEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -466,9 +842,14 @@ func (client *Client) Referrer(filter *Filter) ([]ReferrerStats, error) {
 
 // OS returns operating system statistics.
 func (client *Client) OS(filter *Filter) ([]OSStats, error) {
+	return client.OSContext(context.Background(), filter)
+}
+
+// OSContext is the same as OS, but accepts a context.
+func (client *Client) OSContext(ctx context.Context, filter *Filter) ([]OSStats, error) {
 	stats := make([]OSStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(osEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, osEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -477,9 +858,14 @@ func (client *Client) OS(filter *Filter) ([]OSStats, error) {
 
 // OSVersions returns operating system version statistics.
 func (client *Client) OSVersions(filter *Filter) ([]OSVersionStats, error) {
+	return client.OSVersionsContext(context.Background(), filter)
+}
+
+// OSVersionsContext is the same as OSVersions, but accepts a context.
+func (client *Client) OSVersionsContext(ctx context.Context, filter *Filter) ([]OSVersionStats, error) {
 	stats := make([]OSVersionStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(osVersionEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, osVersionEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -488,9 +874,14 @@ func (client *Client) OSVersions(filter *Filter) ([]OSVersionStats, error) {
 
 // Browser returns browser statistics.
 func (client *Client) Browser(filter *Filter) ([]BrowserStats, error) {
+	return client.BrowserContext(context.Background(), filter)
+}
+
+// BrowserContext is the same as Browser, but accepts a context.
+func (client *Client) BrowserContext(ctx context.Context, filter *Filter) ([]BrowserStats, error) {
 	stats := make([]BrowserStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(browserEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, browserEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -499,9 +890,14 @@ func (client *Client) Browser(filter *Filter) ([]BrowserStats, error) {
 
 // BrowserVersions returns browser version statistics.
 func (client *Client) BrowserVersions(filter *Filter) ([]BrowserVersionStats, error) {
+	return client.BrowserVersionsContext(context.Background(), filter)
+}
+
+// BrowserVersionsContext is the same as BrowserVersions, but accepts a context.
+func (client *Client) BrowserVersionsContext(ctx context.Context, filter *Filter) ([]BrowserVersionStats, error) {
 	stats := make([]BrowserVersionStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(browserVersionEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, browserVersionEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -510,9 +906,14 @@ func (client *Client) BrowserVersions(filter *Filter) ([]BrowserVersionStats, er
 
 // Country returns country statistics.
 func (client *Client) Country(filter *Filter) ([]CountryStats, error) {
+	return client.CountryContext(context.Background(), filter)
+}
+
+// CountryContext is the same as Country, but accepts a context.
+func (client *Client) CountryContext(ctx context.Context, filter *Filter) ([]CountryStats, error) {
 	stats := make([]CountryStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(countryEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, countryEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -521,9 +922,14 @@ func (client *Client) Country(filter *Filter) ([]CountryStats, error) {
 
 // Region returns region statistics.
 func (client *Client) Region(filter *Filter) ([]RegionStats, error) {
+	return client.RegionContext(context.Background(), filter)
+}
+
+// RegionContext is the same as Region, but accepts a context.
+func (client *Client) RegionContext(ctx context.Context, filter *Filter) ([]RegionStats, error) {
 	stats := make([]RegionStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(regionEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, regionEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -532,9 +938,14 @@ func (client *Client) Region(filter *Filter) ([]RegionStats, error) {
 
 // City returns city statistics.
 func (client *Client) City(filter *Filter) ([]CityStats, error) {
+	return client.CityContext(context.Background(), filter)
+}
+
+// CityContext is the same as City, but accepts a context.
+func (client *Client) CityContext(ctx context.Context, filter *Filter) ([]CityStats, error) {
 	stats := make([]CityStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(cityEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, cityEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -543,9 +954,14 @@ func (client *Client) City(filter *Filter) ([]CityStats, error) {
 
 // Platform returns the platforms used by visitors.
 func (client *Client) Platform(filter *Filter) (*PlatformStats, error) {
+	return client.PlatformContext(context.Background(), filter)
+}
+
+// PlatformContext is the same as Platform, but accepts a context.
+func (client *Client) PlatformContext(ctx context.Context, filter *Filter) (*PlatformStats, error) {
 	platforms := new(PlatformStats)
 
-	if err := client.performGet(client.getStatsRequestURL(platformEndpoint, filter), client.requestRetries, platforms); err != nil {
+	if err := client.performStatsGet(ctx, platformEndpoint, filter, platforms); err != nil {
 		return nil, err
 	}
 
@@ -554,9 +970,14 @@ func (client *Client) Platform(filter *Filter) (*PlatformStats, error) {
 
 // Screen returns the screen classes used by visitors.
 func (client *Client) Screen(filter *Filter) ([]ScreenClassStats, error) {
+	return client.ScreenContext(context.Background(), filter)
+}
+
+// ScreenContext is the same as Screen, but accepts a context.
+func (client *Client) ScreenContext(ctx context.Context, filter *Filter) ([]ScreenClassStats, error) {
 	stats := make([]ScreenClassStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(screenEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, screenEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -565,9 +986,14 @@ func (client *Client) Screen(filter *Filter) ([]ScreenClassStats, error) {
 
 // TagKeys returns a list of tag keys.
 func (client *Client) TagKeys(filter *Filter) ([]TagStats, error) {
+	return client.TagKeysContext(context.Background(), filter)
+}
+
+// TagKeysContext is the same as TagKeys, but accepts a context.
+func (client *Client) TagKeysContext(ctx context.Context, filter *Filter) ([]TagStats, error) {
 	stats := make([]TagStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(tagKeysEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, tagKeysEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -576,9 +1002,14 @@ func (client *Client) TagKeys(filter *Filter) ([]TagStats, error) {
 
 // Tags returns a list of tag values for a given tag key.
 func (client *Client) Tags(filter *Filter) ([]TagStats, error) {
+	return client.TagsContext(context.Background(), filter)
+}
+
+// TagsContext is the same as Tags, but accepts a context.
+func (client *Client) TagsContext(ctx context.Context, filter *Filter) ([]TagStats, error) {
 	stats := make([]TagStats, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(tagDetailsEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, tagDetailsEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -587,9 +1018,14 @@ func (client *Client) Tags(filter *Filter) ([]TagStats, error) {
 
 // Keywords returns the Google keywords, rank, and CTR.
 func (client *Client) Keywords(filter *Filter) ([]Keyword, error) {
+	return client.KeywordsContext(context.Background(), filter)
+}
+
+// KeywordsContext is the same as Keywords, but accepts a context.
+func (client *Client) KeywordsContext(ctx context.Context, filter *Filter) ([]Keyword, error) {
 	stats := make([]Keyword, 0)
 
-	if err := client.performGet(client.getStatsRequestURL(keywordsEndpoint, filter), client.requestRetries, &stats); err != nil {
+	if err := client.performStatsGet(ctx, keywordsEndpoint, filter, &stats); err != nil {
 		return nil, err
 	}
 
@@ -598,9 +1034,14 @@ func (client *Client) Keywords(filter *Filter) ([]Keyword, error) {
 
 // ListFunnel returns a list of all funnels including step definition for given domain ID.
 func (client *Client) ListFunnel(id string) ([]Funnel, error) {
+	return client.ListFunnelContext(context.Background(), id)
+}
+
+// ListFunnelContext is the same as ListFunnel, but accepts a context.
+func (client *Client) ListFunnelContext(ctx context.Context, id string) ([]Funnel, error) {
 	funnel := make([]Funnel, 0)
 
-	if err := client.performGet(client.baseURL+fmt.Sprintf(listFunnelEndpoint, id), client.requestRetries, &funnel); err != nil {
+	if err := client.performGet(ctx, client.baseURL+fmt.Sprintf(listFunnelEndpoint, id), &funnel); err != nil {
 		return nil, err
 	}
 
@@ -609,9 +1050,18 @@ func (client *Client) ListFunnel(id string) ([]Funnel, error) {
 
 // Funnel returns a funnel definition and statistics for given funnel ID and filter.
 func (client *Client) Funnel(id string, filter *Filter) (*FunnelData, error) {
+	return client.FunnelContext(context.Background(), id, filter)
+}
+
+// FunnelContext is the same as Funnel, but accepts a context.
+func (client *Client) FunnelContext(ctx context.Context, id string, filter *Filter) (*FunnelData, error) {
 	var funnel FunnelData
 
-	if err := client.performGet(client.getStatsRequestURL(funnelEndpoint, filter)+fmt.Sprintf("&funnel_id=%s", id), client.requestRetries, &funnel); err != nil {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := client.performGet(ctx, client.getStatsRequestURL(funnelEndpoint, filter)+fmt.Sprintf("&funnel_id=%s", id), &funnel); err != nil {
 		return nil, err
 	}
 
@@ -619,25 +1069,189 @@ func (client *Client) Funnel(id string, filter *Filter) (*FunnelData, error) {
 }
 
 func (client *Client) getPageViewData(r *http.Request, options *PageViewOptions) PageView {
+	pageURL, referrer := client.getURLAndReferrer(r)
+	pageURL = client.selectField(options.URL, pageURL)
+	tags := options.Tags
+
+	if client.urlNormalizer != nil {
+		var pattern string
+		pageURL, pattern = client.urlNormalizer.normalize(r, pageURL)
+		tags = client.urlNormalizer.tags(pattern, tags)
+	}
+
+	secCHWidth := client.selectField(options.SecCHWidth, r.Header.Get("Sec-CH-Width"))
+	secCHViewportWidth := client.selectField(options.SecCHViewportWidth, r.Header.Get("Sec-CH-Viewport-Width"))
+	screenWidth := options.ScreenWidth
+
+	if screenWidth == 0 {
+		screenWidth = getScreenWidth(secCHViewportWidth, secCHWidth)
+	}
+
 	return PageView{
-		URL:                    client.selectField(options.URL, r.URL.String()),
-		IP:                     client.selectField(options.IP, r.RemoteAddr),
+		URL:                    pageURL,
+		IP:                     client.selectField(options.IP, client.ipResolver.ClientIP(r)),
 		UserAgent:              client.selectField(options.UserAgent, r.Header.Get("User-Agent")),
 		AcceptLanguage:         client.selectField(options.AcceptLanguage, r.Header.Get("Accept-Language")),
 		SecCHUA:                client.selectField(options.SecCHUA, r.Header.Get("Sec-CH-UA")),
 		SecCHUAMobile:          client.selectField(options.SecCHUAMobile, r.Header.Get("Sec-CH-UA-Mobile")),
 		SecCHUAPlatform:        client.selectField(options.SecCHUAPlatform, r.Header.Get("Sec-CH-UA-Platform")),
 		SecCHUAPlatformVersion: client.selectField(options.SecCHUAPlatformVersion, r.Header.Get("Sec-CH-UA-Platform-Version")),
-		SecCHWidth:             client.selectField(options.SecCHWidth, r.Header.Get("Sec-CH-Width")),
-		SecCHViewportWidth:     client.selectField(options.SecCHViewportWidth, r.Header.Get("Sec-CH-Viewport-Width")),
+		SecCHWidth:             secCHWidth,
+		SecCHViewportWidth:     secCHViewportWidth,
 		Title:                  options.Title,
-		Referrer:               client.selectField(options.Referrer, client.getReferrerFromHeaderOrQuery(r)),
-		ScreenWidth:            options.ScreenWidth,
+		Referrer:               client.selectField(options.Referrer, referrer),
+		ScreenWidth:            screenWidth,
 		ScreenHeight:           options.ScreenHeight,
-		Tags:                   options.Tags,
+		Tags:                   tags,
 	}
 }
 
+// addTracker registers the tracker to be closed together with the client.
+// It returns false if the client has been closed already.
+func (client *Client) addTracker(tracker *AsyncTracker) bool {
+	client.lifecycleM.Lock()
+	defer client.lifecycleM.Unlock()
+
+	if client.closed.Load() {
+		return false
+	}
+
+	client.trackers[tracker] = struct{}{}
+	return true
+}
+
+func (client *Client) removeTracker(tracker *AsyncTracker) {
+	client.lifecycleM.Lock()
+	defer client.lifecycleM.Unlock()
+	delete(client.trackers, tracker)
+}
+
+func (client *Client) getTrackers() []*AsyncTracker {
+	client.lifecycleM.Lock()
+	defer client.lifecycleM.Unlock()
+	trackers := make([]*AsyncTracker, 0, len(client.trackers))
+
+	for tracker := range client.trackers {
+		trackers = append(trackers, tracker)
+	}
+
+	return trackers
+}
+
+func (client *Client) getEventData(name string, durationSeconds int, meta map[string]string, r *http.Request, options *PageViewOptions) Event {
+	return Event{
+		Name:            name,
+		DurationSeconds: durationSeconds,
+		Metadata:        meta,
+		PageView:        client.getPageViewData(r, options),
+	}
+}
+
+func (client *Client) getSessionData(r *http.Request, options *PageViewOptions) PageView {
+	pageURL, _ := client.getURLAndReferrer(r)
+	pageURL = client.selectField(options.URL, pageURL)
+
+	if client.urlNormalizer != nil {
+		pageURL = client.urlNormalizer.Normalize(r, pageURL)
+	}
+
+	return PageView{
+		URL:                    pageURL,
+		IP:                     client.selectField(options.IP, client.ipResolver.ClientIP(r)),
+		UserAgent:              client.selectField(options.UserAgent, r.Header.Get("User-Agent")),
+		SecCHUA:                client.selectField(options.SecCHUA, r.Header.Get("Sec-CH-UA")),
+		SecCHUAMobile:          client.selectField(options.SecCHUAMobile, r.Header.Get("Sec-CH-UA-Mobile")),
+		SecCHUAPlatform:        client.selectField(options.SecCHUAPlatform, r.Header.Get("Sec-CH-UA-Platform")),
+		SecCHUAPlatformVersion: client.selectField(options.SecCHUAPlatformVersion, r.Header.Get("Sec-CH-UA-Platform-Version")),
+		SecCHWidth:             client.selectField(options.SecCHWidth, r.Header.Get("Sec-CH-Width")),
+		SecCHViewportWidth:     client.selectField(options.SecCHViewportWidth, r.Header.Get("Sec-CH-Viewport-Width")),
+	}
+}
+
+func (client *Client) filterBot(pageView *PageView) error {
+	if client.botFilter == nil {
+		return nil
+	}
+
+	return client.botFilter.filter(pageView)
+}
+
+// getURLAndReferrer returns the page URL and referrer for given request.
+// Partial requests (HTMX or Turbo Frames) are attributed to the page they have been sent from without a referrer,
+// as the Referer header points to the page itself. Boosted HTMX navigations use the page they have been sent from as the referrer.
+func (client *Client) getURLAndReferrer(r *http.Request) (string, string) {
+	if partialURL := getPartialURL(r); partialURL != "" {
+		return partialURL, ""
+	}
+
+	if referrer := getNavigationReferrer(r); referrer != "" {
+		return client.getRequestURL(r), referrer
+	}
+
+	return client.getRequestURL(r), client.getReferrerFromHeaderOrQuery(r)
+}
+
+// getRequestURL returns the absolute URL for given request.
+// Requests received by a server only contain the path and query, so the scheme and host are added.
+// The scheme and host forwarded by a proxy are only used if the IPResolver implements the SchemeResolver
+// and HostResolver interfaces and trusts the proxy.
+func (client *Client) getRequestURL(r *http.Request) string {
+	if r.URL.IsAbs() {
+		return r.URL.String()
+	}
+
+	u := *r.URL
+	u.Scheme = "http"
+	u.Host = r.Host
+
+	if resolver, ok := client.ipResolver.(HostResolver); ok {
+		if host := resolver.Host(r); host != "" {
+			u.Host = host
+		}
+	}
+
+	if u.Host == "" {
+		return r.URL.String()
+	}
+
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	if resolver, ok := client.ipResolver.(SchemeResolver); ok {
+		if scheme := resolver.Scheme(r); scheme != "" {
+			u.Scheme = scheme
+		}
+	}
+
+	return u.String()
+}
+
+// handleSpeculativeLoad applies the SpeculativeLoadPolicy and returns ErrSpeculativeLoad if the page view must not be sent.
+func (client *Client) handleSpeculativeLoad(r *http.Request, hit *PageView) error {
+	if client.speculativeLoads == SpeculativeLoadTrack || !isSpeculativeLoad(r) {
+		return nil
+	}
+
+	if client.speculativeLoads == SpeculativeLoadDefer && client.onSpeculativeLoad != nil {
+		client.onSpeculativeLoad(r, BatchPageView{
+			PageView: *hit,
+			Time:     time.Now().UTC(),
+		})
+	}
+
+	return ErrSpeculativeLoad
+}
+
+// handlePartialRequest applies the PartialRequestPolicy and returns ErrPartialRequest if the page view must not be sent.
+func (client *Client) handlePartialRequest(r *http.Request) error {
+	if client.partialRequests == PartialRequestSkip && isPartialRequest(r) {
+		return ErrPartialRequest
+	}
+
+	return nil
+}
+
 func (client *Client) getReferrerFromHeaderOrQuery(r *http.Request) string {
 	referrer := r.Header.Get("Referer")
 
@@ -654,192 +1268,321 @@ func (client *Client) getReferrerFromHeaderOrQuery(r *http.Request) string {
 	return referrer
 }
 
-func (client *Client) refreshToken() error {
-	client.m.Lock()
-	defer client.m.Unlock()
-	client.accessToken = ""
-	client.expiresAt = time.Time{}
-	body := struct {
-		ClientId     string `json:"client_id"`
-		ClientSecret string `json:"client_secret"`
-	}{
-		client.clientID,
-		client.clientSecret,
-	}
-	bodyJson, err := json.Marshal(&body)
+// getAccessToken returns a valid access token, refreshing it if it is missing or about to expire.
+// Concurrent refreshes are collapsed into a single request to the token endpoint.
+func (client *Client) getAccessToken(ctx context.Context) (string, error) {
+	client.m.RLock()
+	accessToken := client.accessToken
+	expiresAt := client.expiresAt
+	client.m.RUnlock()
 
-	if err != nil {
-		return err
+	if accessToken != "" && (expiresAt.IsZero() || time.Until(expiresAt) > tokenRefreshMargin) {
+		return accessToken, nil
 	}
 
-	c := client.getHTTPClient()
-	resp, err := c.Post(client.baseURL+authenticationEndpoint, "application/json", bytes.NewBuffer(bodyJson))
+	if err := client.refreshToken(ctx); err != nil {
+		// keep using the current access token until it actually expires
+		if accessToken != "" && time.Now().Before(expiresAt) {
+			if client.logger != nil {
+				client.logger.Warn("error refreshing token, using current token until it expires", "err", err, "expires_at", expiresAt)
+			}
 
-	if err != nil {
-		return err
+			return accessToken, nil
+		}
+
+		return "", err
 	}
 
-	respJson := struct {
-		AccessToken string    `json:"access_token"`
-		ExpiresAt   time.Time `json:"expires_at"`
-	}{}
+	client.m.RLock()
+	defer client.m.RUnlock()
+	return client.accessToken, nil
+}
+
+// refreshToken fetches a new access token or waits for a refresh already in flight.
+func (client *Client) refreshToken(ctx context.Context) error {
+	client.m.Lock()
+	refresh := client.refresh
 
-	decoder := json.NewDecoder(resp.Body)
+	if refresh == nil {
+		refresh = &tokenRefresh{
+			done: make(chan struct{}),
+		}
+		client.refresh = refresh
 
-	if err := decoder.Decode(&respJson); err != nil {
-		return err
+		// the refresh is shared by all waiting requests, so it must not be canceled together with the first one
+		go client.fetchToken(context.WithoutCancel(ctx), refresh)
 	}
 
-	client.accessToken = respJson.AccessToken
-	client.expiresAt = respJson.ExpiresAt
-	return nil
-}
+	client.m.Unlock()
 
-func (client *Client) performPost(url string, body interface{}, retry int) error {
-	client.m.RLock()
-	accessToken := client.accessToken
-	client.m.RUnlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-refresh.done:
+		return refresh.err
+	}
+}
 
-	if client.clientID != "" && retry > 0 && accessToken == "" {
-		client.waitBeforeNextRequest(retry)
+func (client *Client) fetchToken(ctx context.Context, refresh *tokenRefresh) {
+	token, err := client.tokenSource.Token(ctx)
 
-		if err := client.refreshToken(); err != nil {
-			if client.logger != nil {
-				client.logger.Error("error refreshing token", "err", err)
-			}
+	if err == nil && token.AccessToken == "" {
+		err = errors.New("token source returned an empty access token")
+	}
 
-			return errors.New(fmt.Sprintf("error refreshing token (attempt %d/%d): %s", client.requestRetries-retry, client.requestRetries, err))
-		}
+	client.m.Lock()
+	defer client.m.Unlock()
 
-		return client.performPost(url, body, retry-1)
+	if err == nil {
+		client.accessToken = token.AccessToken
+		client.expiresAt = token.ExpiresAt
 	}
 
-	reqBody, err := json.Marshal(body)
+	refresh.err = err
+	client.refresh = nil
+	close(refresh.done)
+}
 
-	if err != nil {
-		return err
+// invalidateAccessToken removes the access token if it has been rejected by the API.
+// Tokens that have been refreshed concurrently in the meantime are kept.
+func (client *Client) invalidateAccessToken(accessToken string) {
+	client.m.Lock()
+
+	if client.accessToken == accessToken {
+		client.accessToken = ""
+		client.expiresAt = time.Time{}
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(reqBody))
+	client.m.Unlock()
 
-	if err != nil {
-		return err
+	if invalidator, ok := client.tokenSource.(tokenInvalidator); ok {
+		if err := invalidator.InvalidateToken(accessToken); err != nil && client.logger != nil {
+			client.logger.Error("error invalidating token", "err", err)
+		}
 	}
+}
 
-	client.m.RLock()
-	req.Header.Set("Authorization", "Bearer "+client.accessToken)
-	client.m.RUnlock()
-	c := client.getHTTPClient()
-	resp, err := c.Do(req)
+// performTrackingPost sends tracking data submitted by the caller unless the client has been closed.
+func (client *Client) performTrackingPost(ctx context.Context, url string, body any, batch *Batch) error {
+	if client.closed.Load() {
+		return ErrClosed
+	}
 
-	if err != nil {
+	if err := batch.validate(); err != nil {
 		return err
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	return client.postTrackingData(ctx, url, body, batch)
+}
 
-	// refresh access token and retry
-	if client.clientID != "" && retry > 0 && resp.StatusCode != http.StatusOK {
-		client.waitBeforeNextRequest(retry)
+// postTrackingData sends tracking data and writes it to the spool if the API is unavailable.
+// The batch must contain the same data as the body, including the time it occurred.
+func (client *Client) postTrackingData(ctx context.Context, url string, body any, batch *Batch) error {
+	err := client.performPost(ctx, url, body)
 
-		if err := client.refreshToken(); err != nil {
-			if client.logger != nil {
-				client.logger.Error("error refreshing token", "err", err)
-			}
+	// don't spool data if the caller canceled the request
+	if err == nil || client.spool == nil || ctx.Err() != nil || !isTransientError(err) {
+		return err
+	}
 
-			return errors.New(fmt.Sprintf("error refreshing token (attempt %d/%d): %s", client.requestRetries-retry, client.requestRetries, err))
+	if spoolErr := client.spool.Append(batch); spoolErr != nil {
+		if client.logger != nil {
+			client.logger.Error("error writing to spool", "err", spoolErr)
 		}
 
-		return client.performPost(url, body, retry-1)
+		return err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return client.requestError(url, resp.StatusCode, string(body))
+	if client.logger != nil {
+		client.logger.Warn("API unavailable, data has been spooled", "err", err)
 	}
 
 	return nil
 }
 
-func (client *Client) performGet(url string, retry int, result interface{}) error {
-	client.m.RLock()
-	accessToken := client.accessToken
-	client.m.RUnlock()
+// ReplaySpool sends the data written to the spool.
+// This is done periodically in the background, but can be triggered manually, e.g. before the program exits.
+func (client *Client) ReplaySpool(ctx context.Context) error {
+	if client.spool == nil {
+		return nil
+	}
 
-	if client.clientID != "" && retry > 0 && accessToken == "" {
-		client.waitBeforeNextRequest(retry)
+	return client.spool.Replay(ctx, func(ctx context.Context, batch *Batch) error {
+		err := client.sendBatch(ctx, batch)
 
-		if err := client.refreshToken(); err != nil {
+		// drop data that will never be accepted, so that it doesn't block the spool
+		if err != nil && ctx.Err() == nil && !isTransientError(err) {
 			if client.logger != nil {
-				client.logger.Error("error refreshing token", "err", err)
+				client.logger.Error("dropping spooled data rejected by the API", "err", err)
+			}
+
+			return nil
+		}
+
+		return err
+	})
+}
+
+func (client *Client) replaySpool() {
+	ticker := time.NewTicker(client.spool.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.spool.closed:
+			return
+		case <-ticker.C:
+			if err := client.ReplaySpool(context.Background()); err != nil && !errors.Is(err, ErrClosed) && client.logger != nil {
+				client.logger.Debug("error replaying spool", "err", err)
 			}
+		}
+	}
+}
+
+func (client *Client) sendBatch(ctx context.Context, batch *Batch) error {
+	if len(batch.PageViews) > 0 {
+		if err := client.performPost(ctx, client.baseURL+hitBatchEndpoint, batch.PageViews); err != nil {
+			return err
+		}
+	}
 
-			return errors.New(fmt.Sprintf("error refreshing token (attempt %d/%d): %s", client.requestRetries-retry, client.requestRetries, err))
+	if len(batch.Events) > 0 {
+		if err := client.performPost(ctx, client.baseURL+eventBatchEndpoint, batch.Events); err != nil {
+			return err
 		}
+	}
 
-		return client.performGet(url, retry-1, result)
+	if len(batch.Sessions) > 0 {
+		if err := client.performPost(ctx, client.baseURL+sessionBatchEndpoint, batch.Sessions); err != nil {
+			return err
+		}
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	return nil
+}
+
+func (client *Client) performPost(ctx context.Context, url string, body any) error {
+	reqBody, err := json.Marshal(body)
 
 	if err != nil {
 		return err
 	}
 
-	client.m.RLock()
-	req.Header.Set("Authorization", "Bearer "+client.accessToken)
-	client.m.RUnlock()
-	req.Header.Set("Content-Type", "application/json")
-	c := client.getHTTPClient()
-	resp, err := c.Do(req)
+	return client.performRequest(ctx, http.MethodPost, url, reqBody, nil)
+}
 
-	if err != nil {
+func (client *Client) performGet(ctx context.Context, url string, result any) error {
+	return client.performRequest(ctx, http.MethodGet, url, nil, result)
+}
+
+// performStatsGet validates the filter and requests the statistics for given endpoint.
+func (client *Client) performStatsGet(ctx context.Context, endpoint string, filter *Filter, result any) error {
+	if err := filter.Validate(); err != nil {
 		return err
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	return client.performGet(ctx, client.getStatsRequestURL(endpoint, filter), result)
+}
+
+func (client *Client) performRequest(ctx context.Context, method, url string, body []byte, result any) error {
+	budget, ok := client.retryPolicy.(RetryBudget)
+
+	if !ok || budget.Budget() <= 0 {
+		return client.performAttempts(ctx, method, url, body, result)
+	}
 
-	// refresh access token and retry
-	if client.clientID != "" && retry > 0 && resp.StatusCode != http.StatusOK {
-		client.waitBeforeNextRequest(retry)
+	budgetCtx, cancel := context.WithTimeout(ctx, budget.Budget())
+	defer cancel()
+	err := client.performAttempts(budgetCtx, method, url, body, result)
 
-		if err := client.refreshToken(); err != nil {
+	if err != nil && ctx.Err() == nil && errors.Is(budgetCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w (%s): %w", ErrRetryBudgetExceeded, budget.Budget(), err)
+	}
+
+	return err
+}
+
+func (client *Client) performAttempts(ctx context.Context, method, url string, body []byte, result any) error {
+	start := time.Now()
+	var rejectedToken string
+	var rejectedErr error
+
+	for attempt := 1; ; attempt++ {
+		accessToken, err := client.getAccessToken(ctx)
+		refreshFailed := err != nil
+
+		if refreshFailed {
 			if client.logger != nil {
 				client.logger.Error("error refreshing token", "err", err)
 			}
 
-			return errors.New(fmt.Sprintf("error refreshing token (attempt %d/%d): %s", client.requestRetries-retry, client.requestRetries, err))
+			err = &tokenRefreshError{attempt, err}
+		} else if rejectedToken != "" && accessToken == rejectedToken {
+			// the token source cannot provide a new token (e.g. for single access tokens)
+			return rejectedErr
+		} else {
+			err = client.doRequest(ctx, method, url, accessToken, body, result)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		action, delay := client.retryPolicy.Next(attempt, time.Since(start), err)
+
+		if action == RetryActionRefreshToken {
+			if refreshFailed {
+				return err
+			}
+
+			rejectedToken, rejectedErr = accessToken, err
+			client.invalidateAccessToken(accessToken)
+		} else if action != RetryActionRetry {
+			return err
 		}
 
-		return client.performGet(url, retry-1, result)
+		if err := client.waitBeforeNextRequest(ctx, delay); err != nil {
+			return err
+		}
 	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return client.requestError(url, resp.StatusCode, string(body))
+func (client *Client) doRequest(ctx context.Context, method, url, accessToken string, body []byte, result any) error {
+	var reqBody io.Reader
+
+	if body != nil {
+		reqBody = bytes.NewReader(body)
 	}
 
-	decoder := json.NewDecoder(resp.Body)
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 
-	if err := decoder.Decode(result); err != nil {
+	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.httpClient.Do(req)
 
-func (client *Client) getHTTPClient() http.Client {
-	return http.Client{
-		Timeout: client.timeout,
+	if err != nil {
+		return err
 	}
-}
 
-func (client *Client) requestError(url string, statusCode int, body string) error {
-	if body != "" {
-		return errors.New(fmt.Sprintf("%s: received status code %d on request: %s", url, statusCode, body))
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(req.Method, url, resp)
+	}
+
+	if result != nil {
+		decoder := json.NewDecoder(resp.Body)
+
+		if err := decoder.Decode(result); err != nil {
+			return err
+		}
 	}
 
-	return errors.New(fmt.Sprintf("%s: received status code %d on request", url, statusCode))
+	return nil
 }
 
 func (client *Client) getStatsRequestURL(endpoint string, filter *Filter) string {
@@ -906,8 +1649,20 @@ func (client *Client) setURLParams(v url.Values, param string, params []string)
 	}
 }
 
-func (client *Client) waitBeforeNextRequest(retry int) {
-	time.Sleep(time.Second * time.Duration(client.requestRetries-retry+1))
+func (client *Client) waitBeforeNextRequest(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 func (client *Client) selectField(a, b string) string {
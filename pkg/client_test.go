@@ -1,11 +1,18 @@
 package pkg
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -57,6 +64,26 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestClientGetRequestURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/blog?page=2", nil)
+	req.Host = "example.com"
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	client := NewClient("", "secret", nil)
+	assert.Equal(t, "http://example.com/blog?page=2", client.getRequestURL(req))
+	resolver, err := NewProxyIPResolver([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	client = NewClient("", "secret", &ClientConfig{IPResolver: resolver})
+	assert.Equal(t, "https://example.com/blog?page=2", client.getRequestURL(req))
+	req.Header.Set("X-Forwarded-Host", "spoofed.com, www.example.com")
+	assert.Equal(t, "https://www.example.com/blog?page=2", client.getRequestURL(req))
+	req.RemoteAddr = "198.51.100.1:1234"
+	assert.Equal(t, "http://example.com/blog?page=2", client.getRequestURL(req))
+	req.TLS = new(tls.ConnectionState)
+	assert.Equal(t, "https://example.com/blog?page=2", client.getRequestURL(req))
+	assert.Equal(t, "https://example.com/", client.getRequestURL(httptest.NewRequest(http.MethodGet, "https://example.com/", nil)))
+}
+
 func TestGetStatsRequestURL(t *testing.T) {
 	client := NewClient("", "", nil)
 	url := client.getStatsRequestURL("/api/v1/test", &Filter{
@@ -100,3 +127,230 @@ func TestGetStatsRequestURL(t *testing.T) {
 	})
 	assert.Equal(t, "https://api.pirsch.io/api/v1/test?browser=Firefox&city=New+York&country=us&custom_metric_key=custom_metric_key&custom_metric_type=integer&direction=asc&entry_path=%2Fentry&event=event&event_meta_key=event_meta_key&exit_path=%2Fexit&from=2023-08-01&id=o93jnhf&include_avg_time_on_page=true&language=en&limit=42&meta_meta=value&offset=5&os=Windows&path=%2Fpath&path=%2Fpath%2Ffoo&pattern=%2Fpattern&platform=desktop&referrer=referrer&referrer_name=referrer_name&scale=day&screen_class=XXL&search=search&sort=sort&start=500&tag_tag_key=tag_value&to=2023-08-20&tz=Europe%2FBerlin&utm_campaign=campaign&utm_content=content&utm_medium=medium&utm_source=source&utm_term=term", url)
 }
+
+func TestClientContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err := client.VisitorsContext(ctx, &Filter{DomainID: "id"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientHTTPClient(t *testing.T) {
+	var requests []string
+	client := NewClient("id", "secret", &ClientConfig{
+		BaseURL: "https://pirsch.test",
+		HTTPClient: &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				requests = append(requests, r.URL.Path)
+				rec := httptest.NewRecorder()
+
+				if r.URL.Path == authenticationEndpoint {
+					_, _ = rec.WriteString(`{"access_token": "token", "expires_at": "2100-01-01T00:00:00Z"}`)
+				} else {
+					assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+				}
+
+				return rec.Result(), nil
+			}),
+		},
+	})
+	assert.NoError(t, client.PageView(httptest.NewRequest(http.MethodGet, "https://example.com/", nil), nil))
+	assert.Equal(t, []string{authenticationEndpoint, hitEndpoint}, requests)
+}
+
+func TestClientReuseConfig(t *testing.T) {
+	var tokens []string
+	config := &ClientConfig{
+		BaseURL: "https://pirsch.test",
+		HTTPClient: &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				tokens = append(tokens, r.Header.Get("Authorization"))
+				return httptest.NewRecorder().Result(), nil
+			}),
+		},
+	}
+	first := NewClient("", "first", config)
+	second := NewClient("", "second", config)
+	assert.Nil(t, config.TokenSource)
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.NoError(t, first.PageView(req, nil))
+	assert.NoError(t, second.PageView(req, nil))
+	assert.Equal(t, []string{"Bearer first", "Bearer second"}, tokens)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClientRefreshToken(t *testing.T) {
+	var tokenRequests atomic.Int32
+	var failRefresh atomic.Bool
+	expiresIn := time.Hour
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == authenticationEndpoint {
+			n := tokenRequests.Add(1)
+			time.Sleep(time.Millisecond * 20)
+
+			if failRefresh.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			_, _ = fmt.Fprintf(w, `{"access_token": "token%d", "expires_at": "%s"}`, n, time.Now().Add(expiresIn).Format(time.RFC3339))
+			return
+		}
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token") {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	client := NewClient("id", "secret", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.PageView(req, nil))
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(1), tokenRequests.Load())
+
+	// refresh proactively shortly before the token expires
+	client.m.Lock()
+	client.expiresAt = time.Now().Add(time.Second * 30)
+	client.m.Unlock()
+	assert.NoError(t, client.PageView(req, nil))
+	assert.Equal(t, int32(2), tokenRequests.Load())
+	assert.Equal(t, "token2", client.accessToken)
+
+	// failing refreshes keep the token until it expires
+	failRefresh.Store(true)
+	client.m.Lock()
+	client.expiresAt = time.Now().Add(time.Second * 30)
+	client.m.Unlock()
+	assert.NoError(t, client.PageView(req, nil))
+	assert.Equal(t, "token2", client.accessToken)
+}
+
+func TestClientClose(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Slow") != "" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+
+			return
+		}
+
+		var views []BatchPageView
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&views))
+		received.Add(int32(len(views)))
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	tracker := NewAsyncTracker(client, &AsyncTrackerConfig{
+		FlushInterval: time.Hour,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, tracker.PageView(req, nil))
+	}
+
+	assert.NoError(t, client.Flush(context.Background()))
+	assert.Equal(t, int32(3), received.Load())
+	assert.NoError(t, tracker.PageView(req, nil))
+	assert.NoError(t, client.Close(context.Background()))
+	assert.Equal(t, int32(4), received.Load())
+	assert.ErrorIs(t, client.PageView(req, nil), ErrClosed)
+	assert.ErrorIs(t, tracker.PageView(req, nil), ErrClosed)
+	assert.NoError(t, client.Close(context.Background()))
+
+	// drop data if the deadline expires
+	client = NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+		HTTPClient: &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.Header.Set("X-Slow", "true")
+				return http.DefaultTransport.RoundTrip(r)
+			}),
+		},
+	})
+	tracker = NewAsyncTracker(client, nil)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, tracker.PageView(req, nil))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := client.Close(ctx)
+	var droppedErr *DroppedError
+	assert.True(t, errors.As(err, &droppedErr))
+	assert.Equal(t, 5, droppedErr.Dropped)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientCloseFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+		DefaultTracker: &AsyncTrackerConfig{
+			FlushInterval: time.Hour,
+			OnError:       func(error, *Batch) {},
+		},
+	})
+	tracker := client.DefaultTracker()
+	assert.Same(t, tracker, client.DefaultTracker())
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, tracker.PageView(req, nil))
+	}
+
+	err := client.Close(context.Background())
+	var droppedErr *DroppedError
+	assert.True(t, errors.As(err, &droppedErr))
+	assert.Equal(t, 3, droppedErr.Dropped)
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+	assert.ErrorIs(t, tracker.PageView(req, nil), ErrClosed)
+}
+
+func TestClientDefaultTrackerClosed(t *testing.T) {
+	client := NewClient("", "secret", nil)
+	assert.NoError(t, client.Close(context.Background()))
+	tracker := client.DefaultTracker()
+	assert.Empty(t, client.getTrackers())
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.ErrorIs(t, tracker.PageView(req, nil), ErrClosed)
+	assert.NoError(t, tracker.Flush(context.Background()))
+	assert.NoError(t, tracker.Close(context.Background()))
+}
@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ClientHints is the list of User-Agent Client Hints read from requests by the Client.
+// Browsers only send the low entropy hints Sec-CH-UA, Sec-CH-UA-Mobile, and Sec-CH-UA-Platform by default.
+// The others must be requested using SetClientHintsHeaders.
+var ClientHints = []string{
+	"Sec-CH-UA",
+	"Sec-CH-UA-Mobile",
+	"Sec-CH-UA-Platform",
+	"Sec-CH-UA-Platform-Version",
+	"Sec-CH-Width",
+	"Sec-CH-Viewport-Width",
+}
+
+// SetClientHintsHeaders sets the Accept-CH and Permissions-Policy headers on the response
+// to request the ClientHints on subsequent requests to the same origin.
+// If critical is true, the Critical-CH and Vary headers are set as well, so that the browser retries the first request including the hints.
+// This makes the first page view of a visitor accurate at the cost of an additional round trip.
+// The headers must be set before the response header is written.
+func SetClientHintsHeaders(w http.ResponseWriter, critical bool) {
+	hints := strings.Join(ClientHints, ", ")
+	header := w.Header()
+	header.Add("Accept-CH", hints)
+
+	if critical {
+		header.Add("Critical-CH", hints)
+		header.Add("Vary", hints)
+	}
+
+	features := make([]string, 0, len(ClientHints))
+
+	for _, hint := range ClientHints {
+		features = append(features, strings.ToLower(strings.TrimPrefix(hint, "Sec-"))+"=(self)")
+	}
+
+	header.Add("Permissions-Policy", strings.Join(features, ", "))
+}
+
+// getScreenWidth returns the screen width from the Sec-CH-Viewport-Width or Sec-CH-Width hint.
+// Zero is returned if neither is set or valid.
+func getScreenWidth(viewportWidth, width string) int {
+	for _, value := range []string{viewportWidth, width} {
+		if value == "" {
+			continue
+		}
+
+		// Sec-CH-Width may be a decimal
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+
+		if err == nil && w > 0 {
+			return int(w)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,36 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetClientHintsHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetClientHintsHeaders(w, false)
+	hints := "Sec-CH-UA, Sec-CH-UA-Mobile, Sec-CH-UA-Platform, Sec-CH-UA-Platform-Version, Sec-CH-Width, Sec-CH-Viewport-Width"
+	assert.Equal(t, hints, w.Header().Get("Accept-CH"))
+	assert.Empty(t, w.Header().Get("Critical-CH"))
+	assert.Empty(t, w.Header().Get("Vary"))
+	assert.Equal(t, "ch-ua=(self), ch-ua-mobile=(self), ch-ua-platform=(self), ch-ua-platform-version=(self), ch-width=(self), ch-viewport-width=(self)", w.Header().Get("Permissions-Policy"))
+	w = httptest.NewRecorder()
+	SetClientHintsHeaders(w, true)
+	assert.Equal(t, hints, w.Header().Get("Critical-CH"))
+	assert.Equal(t, hints, w.Header().Get("Vary"))
+}
+
+func TestClientScreenWidthFromClientHints(t *testing.T) {
+	client := NewClient("", "secret", nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Zero(t, client.getPageViewData(req, new(PageViewOptions)).ScreenWidth)
+	req.Header.Set("Sec-CH-Width", "1920.5")
+	assert.Equal(t, 1920, client.getPageViewData(req, new(PageViewOptions)).ScreenWidth)
+	req.Header.Set("Sec-CH-Viewport-Width", "1280")
+	assert.Equal(t, 1280, client.getPageViewData(req, new(PageViewOptions)).ScreenWidth)
+	assert.Equal(t, 800, client.getPageViewData(req, &PageViewOptions{ScreenWidth: 800}).ScreenWidth)
+	assert.Equal(t, 390, client.getPageViewData(req, &PageViewOptions{SecCHViewportWidth: "390"}).ScreenWidth)
+	req.Header.Set("Sec-CH-Viewport-Width", "invalid")
+	assert.Equal(t, 1920, client.getPageViewData(req, new(PageViewOptions)).ScreenWidth)
+}
@@ -0,0 +1,255 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// maxErrorBodySize is the maximum number of bytes read from an error response.
+const maxErrorBodySize = 64 << 10 // 64 KiB
+
+var (
+	// ErrUnauthorized is returned if the API rejects the client credentials or access token.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrRateLimited is returned if the API rejects a request because too many requests have been sent.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrNotFound is returned if the API cannot find the requested resource.
+	ErrNotFound = errors.New("not found")
+
+	// ErrQueueFull is returned if data cannot be queued for sending because the queue is full.
+	ErrQueueFull = errors.New("queue full")
+
+	// ErrClosed is returned if data is submitted after the Client or AsyncTracker has been closed.
+	ErrClosed = errors.New("closed")
+
+	// ErrRetryBudgetExceeded is returned if a request could not be completed within the budget of the RetryPolicy.
+	ErrRetryBudgetExceeded = errors.New("retry budget exceeded")
+
+	// ErrDomainNotFound is returned by Client.Domain if no domain could be found for the client.
+	ErrDomainNotFound = errors.New("domain not found")
+)
+
+// DroppedError is returned when closing the Client or an AsyncTracker if data could not be sent,
+// because the context is canceled before all data has been sent or the API failed to accept it.
+type DroppedError struct {
+	// Dropped is the number of page views, events, and sessions that have been dropped.
+	Dropped int
+
+	// Err is the context error, or the last error returned by the API otherwise.
+	Err error
+}
+
+// Error implements the error interface.
+func (err *DroppedError) Error() string {
+	return fmt.Sprintf("%d items dropped: %s", err.Dropped, err.Err)
+}
+
+// Unwrap returns the context or API error.
+func (err *DroppedError) Unwrap() error {
+	return err.Err
+}
+
+// ValidationError is returned if a page view, event, or filter is invalid and has not been sent.
+type ValidationError struct {
+	// Fields maps the names of all invalid fields (as used in the API) to validation error messages.
+	Fields map[string]string
+}
+
+// Error implements the error interface.
+func (err *ValidationError) Error() string {
+	fields := make([]string, 0, len(err.Fields))
+
+	for field := range err.Fields {
+		fields = append(fields, field)
+	}
+
+	slices.Sort(fields)
+
+	for i, field := range fields {
+		fields[i] = fmt.Sprintf("%s: %s", field, err.Fields[field])
+	}
+
+	return "validation failed: " + strings.Join(fields, ", ")
+}
+
+// add adds a validation error message for given field.
+func (err *ValidationError) add(field, msg string) {
+	if err.Fields == nil {
+		err.Fields = make(map[string]string)
+	}
+
+	err.Fields[field] = msg
+}
+
+// merge adds all fields of given error using the prefix.
+func (err *ValidationError) merge(prefix string, other error) {
+	var validationErr *ValidationError
+
+	if errors.As(other, &validationErr) {
+		for field, msg := range validationErr.Fields {
+			err.add(prefix+field, msg)
+		}
+	}
+}
+
+// errorOrNil returns the ValidationError if any field is invalid, or nil otherwise.
+func (err *ValidationError) errorOrNil() error {
+	if len(err.Fields) == 0 {
+		return nil
+	}
+
+	return err
+}
+
+// APIErrorResponse is the error payload returned by the Pirsch API.
+type APIErrorResponse struct {
+	// Validation maps field names to validation error messages.
+	Validation map[string]string `json:"validation,omitempty"`
+
+	// Error is a list of general error messages.
+	Error []string `json:"error,omitempty"`
+}
+
+// APIError is returned if the API responds with an unexpected status code.
+// Use errors.Is with ErrUnauthorized, ErrRateLimited, and ErrNotFound to check for common cases,
+// or errors.As to access the details.
+type APIError struct {
+	// StatusCode is the HTTP status code returned by the API.
+	StatusCode int
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// Endpoint is the path of the request without query parameters (e.g. /api/v1/hit).
+	Endpoint string
+
+	// RequestID is the request ID returned by the API, if any.
+	RequestID string
+
+	// Header is the response header.
+	Header http.Header
+
+	// Body is the raw response body.
+	Body []byte
+
+	// Response is the decoded response body, or nil if the body is not a valid error response.
+	Response *APIErrorResponse
+}
+
+// Error implements the error interface.
+func (err *APIError) Error() string {
+	var msg string
+
+	if err.Response != nil {
+		msg = err.Response.String()
+	}
+
+	if msg == "" {
+		msg = strings.TrimSpace(string(err.Body))
+	}
+
+	if msg != "" {
+		return fmt.Sprintf("%s %s: received status code %d on request: %s", err.Method, err.Endpoint, err.StatusCode, msg)
+	}
+
+	return fmt.Sprintf("%s %s: received status code %d on request", err.Method, err.Endpoint, err.StatusCode)
+}
+
+// Is reports whether the status code of the error matches the target sentinel error.
+func (err *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return err.StatusCode == http.StatusUnauthorized
+	case ErrRateLimited:
+		return err.StatusCode == http.StatusTooManyRequests
+	case ErrNotFound:
+		return err.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
+
+// String returns the validation and error messages as a single string.
+func (resp *APIErrorResponse) String() string {
+	var sb strings.Builder
+
+	for _, msg := range resp.Error {
+		if sb.Len() > 0 {
+			sb.WriteString(", ")
+		}
+
+		sb.WriteString(msg)
+	}
+
+	fields := make([]string, 0, len(resp.Validation))
+
+	for field := range resp.Validation {
+		fields = append(fields, field)
+	}
+
+	slices.Sort(fields)
+
+	for _, field := range fields {
+		if sb.Len() > 0 {
+			sb.WriteString(", ")
+		}
+
+		sb.WriteString(fmt.Sprintf("%s: %s", field, resp.Validation[field]))
+	}
+
+	return sb.String()
+}
+
+func newAPIError(method, requestURL string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	endpoint := requestURL
+
+	if u, err := url.Parse(requestURL); err == nil {
+		endpoint = u.Path
+	}
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		Endpoint:   endpoint,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+		Header:     resp.Header,
+		Body:       body,
+	}
+	errResp := new(APIErrorResponse)
+
+	if err := json.Unmarshal(body, errResp); err == nil && (len(errResp.Validation) > 0 || len(errResp.Error) > 0) {
+		apiErr.Response = errResp
+	}
+
+	return apiErr
+}
+
+// isTransientError returns whether the request might succeed later, because the API was unreachable or unavailable.
+// Context errors of the caller are not transient and must be checked using the context itself.
+func isTransientError(err error) bool {
+	var apiErr *APIError
+	var validationErr *ValidationError
+
+	if errors.As(err, &validationErr) {
+		return false
+	}
+
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, ErrRetryBudgetExceeded) {
+		return true
+	}
+
+	return isNetworkError(err)
+}
@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == domainEndpoint {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+
+		w.Header().Set("X-Request-Id", "request-id")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error": ["too many requests"]}`))
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+	})
+	_, err := client.Visitors(&Filter{DomainID: "id"})
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.NotErrorIs(t, err, ErrUnauthorized)
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, http.MethodGet, apiErr.Method)
+	assert.Equal(t, visitorsEndpoint, apiErr.Endpoint)
+	assert.Equal(t, "request-id", apiErr.RequestID)
+	assert.Equal(t, []string{"too many requests"}, apiErr.Response.Error)
+	assert.Equal(t, "GET /api/v1/statistics/visitor: received status code 429 on request: too many requests", apiErr.Error())
+	_, err = client.Domain()
+	assert.ErrorIs(t, err, ErrDomainNotFound)
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	assert.ErrorIs(t, &APIError{StatusCode: http.StatusUnauthorized}, ErrUnauthorized)
+	assert.NotErrorIs(t, &APIError{StatusCode: http.StatusForbidden}, ErrUnauthorized)
+	assert.ErrorIs(t, &APIError{StatusCode: http.StatusNotFound}, ErrNotFound)
+}
+
+func TestAPIErrorResponseString(t *testing.T) {
+	resp := &APIErrorResponse{
+		Validation: map[string]string{"to": "required", "from": "required", "id": "invalid"},
+		Error:      []string{"bad request"},
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "bad request, from: required, id: invalid, to: required", resp.String())
+	}
+}
+
+func TestNewAPIErrorBodyLimit(t *testing.T) {
+	body := strings.Repeat("a", maxErrorBodySize*2)
+	apiErr := newAPIError(http.MethodGet, "https://api.pirsch.io/api/v1/hit", &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	})
+	assert.Len(t, apiErr.Body, maxErrorBodySize)
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"errors"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	pixelURLParam          = "url"
+	pixelTitleParam        = "title"
+	pixelReferrerParam     = "ref"
+	pixelScreenWidthParam  = "w"
+	pixelScreenHeightParam = "h"
+	pixelEventParam        = "event"
+	pixelTagParamPrefix    = "tag_"
+	pixelMetaParamPrefix   = "meta_"
+)
+
+// ErrPageURLRequired is reported by the Pixel handler if the signed data contains no page URL.
+var ErrPageURLRequired = errors.New("page URL required")
+
+// transparentGIF is a 1x1 transparent GIF image.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00,
+	0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00,
+	0x00, 0x02, 0x01, 0x44, 0x00, 0x3b,
+}
+
+// PixelData is the data tracked by the Pixel handler. It's passed in the signed query of the pixel URL.
+type PixelData struct {
+	// URL is the page URL. It's required unless PixelOptions.RefererURL is set.
+	URL string
+
+	// Title is the optional page title.
+	Title string
+
+	// Referrer is the optional referrer.
+	Referrer string
+
+	// ScreenWidth is the optional screen width.
+	ScreenWidth int
+
+	// ScreenHeight is the optional screen height.
+	ScreenHeight int
+
+	// Tags are optional tags added to the page view or event.
+	Tags map[string]string
+
+	// Event is the optional event name. An event is sent instead of a page view if set.
+	Event string
+
+	// EventMeta is the optional event metadata.
+	EventMeta map[string]string
+}
+
+// PixelOptions configures the Pixel handler.
+type PixelOptions struct {
+	// RefererURL uses the Referer header as the page URL if the signed data contains no URL,
+	// which is the page the pixel is embedded in for <noscript> fallbacks.
+	// The Referer header is not signed, so anyone holding a pixel URL can attribute page views and events to arbitrary pages.
+	RefererURL bool
+
+	// Tracker is an optional AsyncTracker used to queue page views and events. pkg.Client.DefaultTracker is used if not set.
+	Tracker *pkg.AsyncTracker
+
+	// OnError is called if the signature is invalid or the page view or event could not be queued. Errors are ignored if not set.
+	// Errors sending queued page views and events are reported by the AsyncTracker.
+	OnError func(r *http.Request, err error)
+}
+
+// PixelURL returns the signed URL for the Pixel handler served at given URL and data.
+func PixelURL(signer *Signer, pixelURL string, data *PixelData) (string, error) {
+	values := make(url.Values)
+	setParam(values, pixelURLParam, data.URL)
+	setParam(values, pixelTitleParam, data.Title)
+	setParam(values, pixelReferrerParam, data.Referrer)
+	setParam(values, pixelEventParam, data.Event)
+
+	if data.ScreenWidth > 0 {
+		values.Set(pixelScreenWidthParam, strconv.Itoa(data.ScreenWidth))
+	}
+
+	if data.ScreenHeight > 0 {
+		values.Set(pixelScreenHeightParam, strconv.Itoa(data.ScreenHeight))
+	}
+
+	for k, v := range data.Tags {
+		values.Set(pixelTagParamPrefix+k, v)
+	}
+
+	for k, v := range data.EventMeta {
+		values.Set(pixelMetaParamPrefix+k, v)
+	}
+
+	return signer.SignURL(pixelURL, values)
+}
+
+// Pixel returns a http.Handler serving a 1x1 transparent GIF and tracking a page view or event for each request.
+// This can be used to track email opens or page views for <noscript> fallbacks where no JavaScript runs.
+// The data is read from the signed query created by PixelURL, so that third parties cannot forge page views or events.
+// Requests with an invalid signature are not tracked, but still receive the image.
+// The visitor IP and headers are read from the request like for pkg.Client.PageView.
+func Pixel(client *pkg.Client, signer *Signer, options *PixelOptions) http.Handler {
+	if options == nil {
+		options = new(PixelOptions)
+	}
+
+	tracker := options.Tracker
+
+	if tracker == nil {
+		tracker = client.DefaultTracker()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Content-Type", "image/gif")
+		header.Set("Content-Length", strconv.Itoa(len(transparentGIF)))
+		header.Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+		header.Set("Pragma", "no-cache")
+		header.Set("Expires", "0")
+
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(transparentGIF)
+		}
+
+		if r.Method != http.MethodGet {
+			return
+		}
+
+		query := r.URL.Query()
+
+		if err := signer.Verify(query); err != nil {
+			if options.OnError != nil {
+				options.OnError(r, err)
+			}
+
+			return
+		}
+
+		data := parsePixelData(query)
+		pageViewOptions := &pkg.PageViewOptions{
+			URL:          data.URL,
+			Title:        data.Title,
+			Referrer:     data.Referrer,
+			ScreenWidth:  data.ScreenWidth,
+			ScreenHeight: data.ScreenHeight,
+			Tags:         data.Tags,
+		}
+
+		if pageViewOptions.URL == "" && options.RefererURL {
+			pageViewOptions.URL = r.Header.Get("Referer")
+		}
+
+		if pageViewOptions.URL == "" {
+			if options.OnError != nil {
+				options.OnError(r, ErrPageURLRequired)
+			}
+
+			return
+		}
+
+		var err error
+
+		if data.Event != "" {
+			err = tracker.Event(data.Event, 0, data.EventMeta, r, pageViewOptions)
+		} else {
+			err = tracker.PageView(r, pageViewOptions)
+		}
+
+		if err != nil && options.OnError != nil {
+			options.OnError(r, err)
+		}
+	})
+}
+
+func parsePixelData(query url.Values) *PixelData {
+	data := &PixelData{
+		URL:      query.Get(pixelURLParam),
+		Title:    query.Get(pixelTitleParam),
+		Referrer: query.Get(pixelReferrerParam),
+		Event:    query.Get(pixelEventParam),
+	}
+	data.ScreenWidth, _ = strconv.Atoi(query.Get(pixelScreenWidthParam))
+	data.ScreenHeight, _ = strconv.Atoi(query.Get(pixelScreenHeightParam))
+
+	for k := range query {
+		if strings.HasPrefix(k, pixelTagParamPrefix) {
+			if data.Tags == nil {
+				data.Tags = make(map[string]string)
+			}
+
+			data.Tags[strings.TrimPrefix(k, pixelTagParamPrefix)] = query.Get(k)
+		} else if strings.HasPrefix(k, pixelMetaParamPrefix) {
+			if data.EventMeta == nil {
+				data.EventMeta = make(map[string]string)
+			}
+
+			data.EventMeta[strings.TrimPrefix(k, pixelMetaParamPrefix)] = query.Get(k)
+		}
+	}
+
+	return data
+}
+
+func setParam(values url.Values, key, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
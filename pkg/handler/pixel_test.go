@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPixel(t *testing.T) {
+	pageViews := make(chan pkg.PageView, 10)
+	events := make(chan pkg.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/event/batch" {
+			var batch []pkg.BatchEvent
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+			for _, event := range batch {
+				events <- event.Event
+			}
+
+			return
+		}
+
+		var views []pkg.BatchPageView
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&views))
+
+		for _, view := range views {
+			pageViews <- view.PageView
+		}
+	}))
+	defer server.Close()
+	client := pkg.NewClient("", "secret", &pkg.ClientConfig{
+		BaseURL: server.URL,
+		DefaultTracker: &pkg.AsyncTrackerConfig{
+			BatchSize: 1,
+		},
+	})
+	signer := NewSigner([]byte("secret"))
+	errs := make(chan error, 10)
+	handler := Pixel(client, signer, &PixelOptions{
+		OnError: func(r *http.Request, err error) {
+			errs <- err
+		},
+	})
+	pixelURL, err := PixelURL(signer, "https://example.com/pixel.gif", &PixelData{
+		URL:         "https://example.com/newsletter/1",
+		Title:       "Newsletter",
+		ScreenWidth: 1920,
+		Tags:        map[string]string{"campaign": "launch"},
+	})
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, pixelURL, nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/gif", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Cache-Control"), "no-store")
+	assert.Equal(t, transparentGIF, w.Body.Bytes())
+
+	select {
+	case hit := <-pageViews:
+		assert.Equal(t, "https://example.com/newsletter/1", hit.URL)
+		assert.Equal(t, "Newsletter", hit.Title)
+		assert.Equal(t, 1920, hit.ScreenWidth)
+		assert.Equal(t, "launch", hit.Tags["campaign"])
+		assert.Equal(t, "192.0.2.1", hit.IP)
+	case <-time.After(time.Second):
+		t.Fatal("page view not received")
+	}
+
+	pixelURL, err = PixelURL(signer, "https://example.com/pixel.gif", &PixelData{
+		Event:     "Email Opened",
+		EventMeta: map[string]string{"template": "welcome"},
+	})
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, pixelURL, nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0")
+	req.Header.Set("Referer", "https://example.com/noscript")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.ErrorIs(t, <-errs, ErrPageURLRequired)
+	handler = Pixel(client, signer, &PixelOptions{
+		RefererURL: true,
+		OnError: func(r *http.Request, err error) {
+			errs <- err
+		},
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "Email Opened", event.Name)
+		assert.Equal(t, "welcome", event.Metadata["template"])
+		assert.Equal(t, "https://example.com/noscript", event.URL)
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/pixel.gif?url=https%3A%2F%2Fexample.com%2Fforged", nil))
+	assert.Equal(t, transparentGIF, w.Body.Bytes())
+	assert.ErrorIs(t, <-errs, ErrInvalidSignature)
+	assert.Empty(t, pageViews)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultScriptURL is the URL of the Pirsch JavaScript snippet served by the Proxy by default.
+	DefaultScriptURL = "https://api.pirsch.io/pa.js"
+
+	defaultScriptCacheMaxAge = time.Hour * 24
+	defaultScriptTimeout     = time.Second * 10
+	maxBeaconSize            = 64 << 10 // 64 KiB
+	beaconTagParamPrefix     = "tag_"
+)
+
+var errEventNameRequired = errors.New("event name required")
+
+// ProxyOptions configures the Proxy.
+type ProxyOptions struct {
+	// ScriptURL is the URL the JavaScript snippet is loaded from. DefaultScriptURL by default.
+	ScriptURL string
+
+	// ScriptCacheMaxAge is the time after which the cached JavaScript snippet is loaded again. 24 hours by default.
+	// The cached snippet is served as long as it cannot be loaded.
+	ScriptCacheMaxAge time.Duration
+
+	// HTTPClient is the http.Client used to load the JavaScript snippet. A client with a timeout of 10 seconds is used by default.
+	HTTPClient *http.Client
+
+	// Tracker is an optional AsyncTracker used to queue page views, events, and sessions.
+	// They are sent before the beacon request returns if not set.
+	Tracker *pkg.AsyncTracker
+
+	// OnError is called if the JavaScript snippet could not be loaded or a beacon could not be sent. Errors are ignored if not set.
+	OnError func(r *http.Request, err error)
+}
+
+// Proxy serves the Pirsch JavaScript snippet and accepts its page view, event, and session beacons on your own domain,
+// so that they are not blocked by ad blockers.
+// Beacons are sent to Pirsch using the pkg.Client, which reads the visitor IP and Client Hints from the original request
+// and authenticates using the server-side access token. The identification code set on the script tag is ignored.
+// Beacons are answered with status code 400 for invalid data, 204 for skipped speculative loads and partial requests,
+// and 502 if they could not be sent.
+//
+// Mount the handlers on your own paths and configure the snippet to use them:
+//
+//	<script defer src="/p/pa.js" id="pianjs" data-code="..."
+//		data-hit-endpoint="/p/hit" data-event-endpoint="/p/event" data-session-endpoint="/p/session"></script>
+type Proxy struct {
+	client        *pkg.Client
+	scriptURL     string
+	cacheMaxAge   time.Duration
+	httpClient    *http.Client
+	tracker       *pkg.AsyncTracker
+	onError       func(*http.Request, error)
+	script        []byte
+	scriptETag    string
+	scriptType    string
+	scriptLoaded  time.Time
+	scriptModTime time.Time
+	fetch         *scriptFetch
+	m             sync.Mutex
+}
+
+// scriptFetch is a request for the JavaScript snippet in flight shared by all requests waiting for it.
+type scriptFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// proxyBeacon is the JSON body sent by the JavaScript snippet.
+type proxyBeacon struct {
+	URL           string            `json:"url"`
+	Title         string            `json:"title"`
+	Referrer      string            `json:"referrer"`
+	ScreenWidth   int               `json:"screen_width"`
+	ScreenHeight  int               `json:"screen_height"`
+	Tags          map[string]string `json:"tags"`
+	EventName     string            `json:"event_name"`
+	EventDuration int               `json:"event_duration"`
+	EventMeta     map[string]string `json:"event_meta"`
+}
+
+// NewProxy creates a new Proxy for given Client and optional configuration.
+func NewProxy(client *pkg.Client, options *ProxyOptions) *Proxy {
+	if options == nil {
+		options = new(ProxyOptions)
+	}
+
+	if options.ScriptURL == "" {
+		options.ScriptURL = DefaultScriptURL
+	}
+
+	if options.ScriptCacheMaxAge <= 0 {
+		options.ScriptCacheMaxAge = defaultScriptCacheMaxAge
+	}
+
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{
+			Timeout: defaultScriptTimeout,
+		}
+	}
+
+	return &Proxy{
+		client:      client,
+		scriptURL:   options.ScriptURL,
+		cacheMaxAge: options.ScriptCacheMaxAge,
+		httpClient:  options.HTTPClient,
+		tracker:     options.Tracker,
+		onError:     options.OnError,
+	}
+}
+
+// Script returns a http.Handler serving the JavaScript snippet.
+// The snippet is cached in memory and supports conditional requests using the ETag header.
+// Once it has expired, it's loaded again in the background, while the cached snippet is served.
+// The Client Hints read by the pkg.Client are requested from the browser, so that they are included in the beacons.
+func (proxy *Proxy) Script() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		script, etag, contentType, modTime, err := proxy.getScript(r)
+
+		if err != nil {
+			proxy.handleError(r, err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+
+		pkg.SetClientHintsHeaders(w, false)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(proxy.cacheMaxAge.Seconds())))
+		http.ServeContent(w, r, "", modTime, bytes.NewReader(script))
+	})
+}
+
+// Hit returns a http.Handler accepting page view beacons.
+func (proxy *Proxy) Hit() http.Handler {
+	return proxy.beacon(func(r *http.Request, beacon *proxyBeacon, options *pkg.PageViewOptions) error {
+		if proxy.tracker != nil {
+			return proxy.tracker.PageView(r, options)
+		}
+
+		return proxy.client.PageViewContext(r.Context(), r, options)
+	})
+}
+
+// Event returns a http.Handler accepting event beacons.
+func (proxy *Proxy) Event() http.Handler {
+	return proxy.beacon(func(r *http.Request, beacon *proxyBeacon, options *pkg.PageViewOptions) error {
+		if beacon.EventName == "" {
+			return errEventNameRequired
+		}
+
+		if proxy.tracker != nil {
+			return proxy.tracker.Event(beacon.EventName, beacon.EventDuration, beacon.EventMeta, r, options)
+		}
+
+		return proxy.client.EventContext(r.Context(), beacon.EventName, beacon.EventDuration, beacon.EventMeta, r, options)
+	})
+}
+
+// Session returns a http.Handler accepting session keep-alive beacons.
+func (proxy *Proxy) Session() http.Handler {
+	return proxy.beacon(func(r *http.Request, beacon *proxyBeacon, options *pkg.PageViewOptions) error {
+		if proxy.tracker != nil {
+			return proxy.tracker.Session(r, options)
+		}
+
+		return proxy.client.SessionContext(r.Context(), r, options)
+	})
+}
+
+func (proxy *Proxy) beacon(send func(*http.Request, *proxyBeacon, *pkg.PageViewOptions) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		beacon, err := parseBeacon(r)
+
+		if err != nil {
+			proxy.handleError(r, err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		pkg.SetClientHintsHeaders(w, false)
+		w.Header().Set("Cache-Control", "no-store")
+
+		// the referrer is read from the beacon only, because the Referer header and query of the beacon request
+		// belong to the page sending it, which would otherwise become its own referrer for direct visits
+		req := r.Clone(r.Context())
+		req.Header.Del("Referer")
+		req.URL.RawQuery = ""
+		err = send(req, beacon, &pkg.PageViewOptions{
+			URL:          beacon.URL,
+			Title:        beacon.Title,
+			Referrer:     beacon.Referrer,
+			ScreenWidth:  beacon.ScreenWidth,
+			ScreenHeight: beacon.ScreenHeight,
+			Tags:         beacon.Tags,
+		})
+
+		var validationErr *pkg.ValidationError
+
+		if errors.Is(err, errEventNameRequired) || errors.As(err, &validationErr) {
+			proxy.handleError(r, err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if errors.Is(err, pkg.ErrSpeculativeLoad) || errors.Is(err, pkg.ErrPartialRequest) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		} else if err != nil && !errors.Is(err, pkg.ErrFilteredBot) {
+			proxy.handleError(r, err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// getScript returns the cached JavaScript snippet and starts loading it again once it has expired.
+// The expired snippet is served while it is loaded. Requests wait for the snippet if it hasn't been loaded yet.
+func (proxy *Proxy) getScript(r *http.Request) ([]byte, string, string, time.Time, error) {
+	proxy.m.Lock()
+
+	if proxy.script != nil && time.Since(proxy.scriptLoaded) <= proxy.cacheMaxAge {
+		defer proxy.m.Unlock()
+		return proxy.script, proxy.scriptETag, proxy.scriptType, proxy.scriptModTime, nil
+	}
+
+	fetch := proxy.fetch
+
+	if fetch == nil {
+		fetch = &scriptFetch{
+			done: make(chan struct{}),
+		}
+		proxy.fetch = fetch
+
+		// the fetch is shared by all waiting requests, so it must not be canceled together with the first one,
+		// and the request is copied, as it's passed to OnError after the handler might have returned
+		go proxy.loadScript(r.Clone(context.WithoutCancel(r.Context())), fetch)
+	}
+
+	if proxy.script != nil {
+		defer proxy.m.Unlock()
+		return proxy.script, proxy.scriptETag, proxy.scriptType, proxy.scriptModTime, nil
+	}
+
+	proxy.m.Unlock()
+
+	select {
+	case <-r.Context().Done():
+		return nil, "", "", time.Time{}, r.Context().Err()
+	case <-fetch.done:
+		if fetch.err != nil {
+			return nil, "", "", time.Time{}, fetch.err
+		}
+	}
+
+	proxy.m.Lock()
+	defer proxy.m.Unlock()
+	return proxy.script, proxy.scriptETag, proxy.scriptType, proxy.scriptModTime, nil
+}
+
+func (proxy *Proxy) loadScript(r *http.Request, fetch *scriptFetch) {
+	proxy.m.Lock()
+	etag := proxy.scriptETag
+	proxy.m.Unlock()
+	script, etag, contentType, err := proxy.fetchScript(r.Context(), etag)
+	proxy.m.Lock()
+	var staleErr error
+
+	if err != nil && proxy.script != nil {
+		// serve the cached script and try again later
+		staleErr = err
+		err = nil
+	} else if err == nil && script != nil {
+		if etag != proxy.scriptETag {
+			proxy.scriptModTime = time.Now().UTC()
+		}
+
+		proxy.script = script
+		proxy.scriptETag = etag
+		proxy.scriptType = contentType
+	}
+
+	if err == nil {
+		proxy.scriptLoaded = time.Now()
+	}
+
+	fetch.err = err
+	proxy.fetch = nil
+	close(fetch.done)
+	proxy.m.Unlock()
+
+	// OnError is called without holding the lock, so that it cannot block requests for the script
+	if staleErr != nil {
+		proxy.handleError(r, staleErr)
+	}
+}
+
+// fetchScript loads the JavaScript snippet. No script is returned if it hasn't changed since given ETag.
+func (proxy *Proxy) fetchScript(ctx context.Context, etag string) ([]byte, string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, proxy.scriptURL, nil)
+
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := proxy.httpClient.Do(req)
+
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return nil, etag, "", nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("error loading script %s: received status code %d", proxy.scriptURL, resp.StatusCode)
+	}
+
+	script, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	hash := sha256.Sum256(script)
+	contentType := resp.Header.Get("Content-Type")
+
+	if contentType == "" {
+		contentType = "application/javascript"
+	}
+
+	return script, `"` + hex.EncodeToString(hash[:16]) + `"`, contentType, nil
+}
+
+func (proxy *Proxy) handleError(r *http.Request, err error) {
+	if proxy.onError != nil {
+		proxy.onError(r, err)
+	}
+}
+
+// parseBeacon reads the beacon data from the query parameters and JSON body of the request.
+func parseBeacon(r *http.Request) (*proxyBeacon, error) {
+	query := r.URL.Query()
+	beacon := &proxyBeacon{
+		URL:      query.Get("url"),
+		Title:    query.Get("t"),
+		Referrer: query.Get("ref"),
+	}
+	beacon.ScreenWidth, _ = strconv.Atoi(query.Get("w"))
+	beacon.ScreenHeight, _ = strconv.Atoi(query.Get("h"))
+
+	for k := range query {
+		if strings.HasPrefix(k, beaconTagParamPrefix) {
+			if beacon.Tags == nil {
+				beacon.Tags = make(map[string]string)
+			}
+
+			beacon.Tags[strings.TrimPrefix(k, beaconTagParamPrefix)] = query.Get(k)
+		}
+	}
+
+	if r.Method == http.MethodPost && r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBeaconSize))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, beacon); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if beacon.URL == "" {
+		return nil, errors.New("url required")
+	}
+
+	return beacon, nil
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyScript(t *testing.T) {
+	var requests atomic.Int32
+	var fail atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/javascript")
+		_, _ = w.Write([]byte("console.log('pirsch');"))
+	}))
+	defer server.Close()
+	proxy := NewProxy(pkg.NewClient("", "secret", nil), &ProxyOptions{
+		ScriptURL: server.URL + "/pa.js",
+	})
+	handler := proxy.Script()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/pa.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "console.log('pirsch');", w.Body.String())
+	assert.Equal(t, "text/javascript", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Accept-CH"), "Sec-CH-UA-Platform-Version")
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	req := httptest.NewRequest(http.MethodGet, "/p/pa.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, int32(1), requests.Load())
+
+	// the cached script is served if it cannot be loaded again
+	proxy.scriptLoaded = proxy.scriptLoaded.Add(-proxy.cacheMaxAge * 2)
+	fail.Store(true)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/pa.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "console.log('pirsch');", w.Body.String())
+	waitForScriptFetch(proxy)
+	assert.Equal(t, int32(2), requests.Load())
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/pa.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(2), requests.Load())
+	proxy = NewProxy(pkg.NewClient("", "secret", nil), &ProxyOptions{
+		ScriptURL: server.URL + "/pa.js",
+	})
+	w = httptest.NewRecorder()
+	proxy.Script().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/pa.js", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestProxyScriptConcurrent(t *testing.T) {
+	var requests atomic.Int32
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-block
+		_, _ = w.Write([]byte("console.log('pirsch');"))
+	}))
+	defer server.Close()
+	proxy := NewProxy(pkg.NewClient("", "secret", nil), &ProxyOptions{
+		ScriptURL: server.URL + "/pa.js",
+	})
+	handler := proxy.Script()
+
+	// the first visitor disconnects while the script is loaded
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/pa.js", nil).WithContext(ctx))
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/pa.js", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "console.log('pirsch');", w.Body.String())
+		}()
+	}
+
+	cancel()
+	<-done
+	time.Sleep(time.Millisecond * 20)
+	close(block)
+	wg.Wait()
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestProxyBeacons(t *testing.T) {
+	pageViews := make(chan pkg.PageView, 10)
+	events := make(chan pkg.Event, 10)
+	sessions := make(chan pkg.PageView, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		switch r.URL.Path {
+		case "/api/v1/hit":
+			var hit pkg.PageView
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&hit))
+			pageViews <- hit
+		case "/api/v1/event":
+			var event pkg.Event
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+			events <- event
+		case "/api/v1/session":
+			var session pkg.PageView
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&session))
+			sessions <- session
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	proxy := NewProxy(pkg.NewClient("", "secret", &pkg.ClientConfig{
+		BaseURL: server.URL,
+	}), nil)
+	browser := "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"
+	req := httptest.NewRequest(http.MethodGet, "/p/hit?nc=123&code=abc&url=https%3A%2F%2Fexample.com%2Fblog&t=Blog&ref=https%3A%2F%2Fgoogle.com&w=1920&h=1080&tag_author=john", nil)
+	req.RemoteAddr = "198.51.100.1:54321"
+	req.Header.Set("User-Agent", browser)
+	req.Header.Set("Sec-CH-UA-Platform-Version", `"15.0.0"`)
+	w := httptest.NewRecorder()
+	proxy.Hit().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	hit := <-pageViews
+	assert.Equal(t, "https://example.com/blog", hit.URL)
+	assert.Equal(t, "Blog", hit.Title)
+	assert.Equal(t, "https://google.com", hit.Referrer)
+	assert.Equal(t, 1920, hit.ScreenWidth)
+	assert.Equal(t, 1080, hit.ScreenHeight)
+	assert.Equal(t, "john", hit.Tags["author"])
+	assert.Equal(t, "198.51.100.1", hit.IP)
+	assert.Equal(t, browser, hit.UserAgent)
+	assert.Equal(t, `"15.0.0"`, hit.SecCHUAPlatformVersion)
+
+	// the Referer header of the beacon is the page itself and must not be used for direct visits
+	req = httptest.NewRequest(http.MethodGet, "/p/hit?nc=123&code=abc&url=https%3A%2F%2Fexample.com%2Fblog", nil)
+	req.Header.Set("User-Agent", browser)
+	req.Header.Set("Referer", "https://example.com/blog")
+	w = httptest.NewRecorder()
+	proxy.Hit().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	hit = <-pageViews
+	assert.Equal(t, "https://example.com/blog", hit.URL)
+	assert.Empty(t, hit.Referrer)
+	req = httptest.NewRequest(http.MethodPost, "/p/event", strings.NewReader(`{"identification_code":"abc","url":"https://example.com/blog","title":"Blog","event_name":"Signup","event_duration":42,"event_meta":{"plan":"pro"}}`))
+	req.RemoteAddr = "198.51.100.1:54321"
+	req.Header.Set("User-Agent", browser)
+	w = httptest.NewRecorder()
+	proxy.Event().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	event := <-events
+	assert.Equal(t, "Signup", event.Name)
+	assert.Equal(t, 42, event.DurationSeconds)
+	assert.Equal(t, "pro", event.Metadata["plan"])
+	assert.Equal(t, "https://example.com/blog", event.URL)
+	assert.Equal(t, "198.51.100.1", event.IP)
+	req = httptest.NewRequest(http.MethodPost, "/p/session?nc=123&code=abc&url=https%3A%2F%2Fexample.com%2Fblog", nil)
+	req.RemoteAddr = "198.51.100.1:54321"
+	req.Header.Set("User-Agent", browser)
+	w = httptest.NewRecorder()
+	proxy.Session().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	session := <-sessions
+	assert.Equal(t, "https://example.com/blog", session.URL)
+	assert.Equal(t, "198.51.100.1", session.IP)
+	w = httptest.NewRecorder()
+	proxy.Hit().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/hit", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	proxy.Event().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/p/event", strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// invalid data is rejected and speculative loads are skipped without being sent
+	req = httptest.NewRequest(http.MethodGet, "/p/hit?url=https%3A%2F%2Fexample.com%2F"+strings.Repeat("a", pkg.MaxURLLength), nil)
+	req.Header.Set("User-Agent", browser)
+	w = httptest.NewRecorder()
+	proxy.Hit().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	req = httptest.NewRequest(http.MethodGet, "/p/hit?url=https%3A%2F%2Fexample.com%2F", nil)
+	req.Header.Set("User-Agent", browser)
+	req.Header.Set("Sec-Purpose", "prefetch")
+	w = httptest.NewRecorder()
+	proxy.Hit().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, pageViews)
+}
+
+func waitForScriptFetch(proxy *Proxy) {
+	proxy.m.Lock()
+	fetch := proxy.fetch
+	proxy.m.Unlock()
+
+	if fetch != nil {
+		<-fetch.done
+	}
+}
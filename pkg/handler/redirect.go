@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	redirectTargetParam = "to"
+
+	// OutboundLinkEvent is the event name used for clicks on outbound links.
+	OutboundLinkEvent = "Outbound Link Click"
+
+	// FileDownloadEvent is the event name used for file downloads.
+	FileDownloadEvent = "File Download"
+)
+
+// ErrInvalidTarget is returned if the redirect target is not an absolute http or https URL.
+var ErrInvalidTarget = errors.New("invalid redirect target")
+
+// DefaultDownloadExtensions is the list of file extensions tracked as FileDownloadEvent by default.
+var DefaultDownloadExtensions = []string{
+	".pdf",
+	".zip",
+	".gz",
+	".tar",
+	".7z",
+	".rar",
+	".dmg",
+	".exe",
+	".msi",
+	".deb",
+	".rpm",
+	".apk",
+	".csv",
+	".xlsx",
+	".docx",
+	".pptx",
+	".mp3",
+	".mp4",
+}
+
+// RedirectOptions configures the Redirect handler.
+type RedirectOptions struct {
+	// DownloadExtensions is a list of file extensions (including the dot) tracked as FileDownloadEvent.
+	// DefaultDownloadExtensions is used if not set.
+	DownloadExtensions []string
+
+	// EventName is an optional callback returning the event name for given target URL.
+	// FileDownloadEvent is used for targets ending with one of the DownloadExtensions, OutboundLinkEvent otherwise.
+	EventName func(target *url.URL, download bool) string
+
+	// Tracker is an optional AsyncTracker used to queue events. pkg.Client.DefaultTracker is used if not set.
+	Tracker *pkg.AsyncTracker
+
+	// OnError is called if the signature or target is invalid or the event could not be queued. Errors are ignored if not set.
+	// Errors sending queued events are reported by the AsyncTracker.
+	OnError func(r *http.Request, err error)
+}
+
+// RedirectURL returns the signed URL for the Redirect handler served at given URL and target.
+func RedirectURL(signer *Signer, redirectURL, target string) (string, error) {
+	if _, err := parseTarget(target); err != nil {
+		return "", err
+	}
+
+	return signer.SignURL(redirectURL, url.Values{redirectTargetParam: {target}})
+}
+
+// RedirectFuncs returns template functions to create signed links for the Redirect handler served at given URL.
+// The trackedLink function takes the target URL and can be used in the href attribute of links in html/template.
+//
+//	<a href="{{trackedLink "https://example.com/file.pdf"}}">Download</a>
+func RedirectFuncs(signer *Signer, redirectURL string) template.FuncMap {
+	return template.FuncMap{
+		"trackedLink": func(target string) (template.URL, error) {
+			link, err := RedirectURL(signer, redirectURL, target)
+
+			if err != nil {
+				return "", err
+			}
+
+			return template.URL(link), nil
+		},
+	}
+}
+
+// Redirect returns a http.Handler tracking an event for outbound links and file downloads and redirecting to the target.
+// The target is read from the signed query created by RedirectURL, so that the handler cannot be used as an open redirect.
+// The event metadata includes the target URL, host, file extension, and the page the link has been clicked on (Referer header).
+// Metadata values longer than pkg.MaxValueLength are truncated.
+// The visitor is redirected immediately using status code 302, even if the event could not be sent.
+func Redirect(client *pkg.Client, signer *Signer, options *RedirectOptions) http.Handler {
+	if options == nil {
+		options = new(RedirectOptions)
+	}
+
+	downloadExtensions := options.DownloadExtensions
+
+	if downloadExtensions == nil {
+		downloadExtensions = DefaultDownloadExtensions
+	}
+
+	tracker := options.Tracker
+
+	if tracker == nil {
+		tracker = client.DefaultTracker()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		err := signer.Verify(query)
+		var target *url.URL
+
+		if err == nil {
+			target, err = parseTarget(query.Get(redirectTargetParam))
+		}
+
+		if err != nil {
+			if options.OnError != nil {
+				options.OnError(r, err)
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, target.String(), http.StatusFound)
+		ext := strings.ToLower(path.Ext(target.Path))
+		download := false
+
+		for _, downloadExt := range downloadExtensions {
+			if ext == downloadExt {
+				download = true
+				break
+			}
+		}
+
+		name := OutboundLinkEvent
+
+		if options.EventName != nil {
+			name = options.EventName(target, download)
+		} else if download {
+			name = FileDownloadEvent
+		}
+
+		// metadata values are truncated, so that long URLs don't cause the event to be rejected
+		source := r.Header.Get("Referer")
+		meta := map[string]string{
+			"url":  pkg.TruncateValue(target.String()),
+			"host": target.Hostname(),
+		}
+
+		if ext != "" {
+			meta["extension"] = pkg.TruncateValue(ext)
+		}
+
+		if source != "" {
+			meta["source"] = pkg.TruncateValue(source)
+		}
+
+		// the event belongs to the page the link has been clicked on
+		pageViewOptions := &pkg.PageViewOptions{
+			URL: source,
+		}
+
+		if err := tracker.Event(name, 0, meta, r, pageViewOptions); err != nil && options.OnError != nil {
+			options.OnError(r, err)
+		}
+	})
+}
+
+func parseTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidTarget
+	}
+
+	return u, nil
+}
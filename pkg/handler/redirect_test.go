@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"github.com/stretchr/testify/assert"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedirect(t *testing.T) {
+	events := make(chan pkg.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []pkg.BatchEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+		for _, event := range batch {
+			events <- event.Event
+		}
+	}))
+	defer server.Close()
+	client := pkg.NewClient("", "secret", &pkg.ClientConfig{
+		BaseURL: server.URL,
+		DefaultTracker: &pkg.AsyncTrackerConfig{
+			BatchSize: 1,
+		},
+	})
+	signer := NewSigner([]byte("secret"))
+	handler := Redirect(client, signer, nil)
+	input := []struct {
+		target string
+		name   string
+		ext    string
+	}{
+		{"https://github.com/pirsch-analytics", OutboundLinkEvent, ""},
+		{"https://example.com/files/Report.PDF?v=2", FileDownloadEvent, ".pdf"},
+		{"https://example.com/search?q=" + strings.Repeat("q", pkg.MaxValueLength), OutboundLinkEvent, ""},
+	}
+
+	for _, in := range input {
+		link, err := RedirectURL(signer, "https://example.com/out", in.target)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0")
+		req.Header.Set("Referer", "https://example.com/blog")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, in.target, w.Header().Get("Location"))
+
+		select {
+		case event := <-events:
+			assert.Equal(t, in.name, event.Name)
+			assert.Equal(t, "https://example.com/blog", event.URL)
+			assert.Equal(t, pkg.TruncateValue(in.target), event.Metadata["url"])
+			assert.Equal(t, "https://example.com/blog", event.Metadata["source"])
+			assert.Equal(t, in.ext, event.Metadata["extension"])
+			assert.NotEmpty(t, event.Metadata["host"])
+		case <-time.After(time.Second):
+			t.Fatal("event not received")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/out?to=https%3A%2F%2Fevil.com", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	_, err := RedirectURL(signer, "https://example.com/out", "javascript:alert(1)")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+func TestRedirectFailingAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	errs := make(chan error, 1)
+	client := pkg.NewClient("", "secret", &pkg.ClientConfig{
+		BaseURL: server.URL,
+		DefaultTracker: &pkg.AsyncTrackerConfig{
+			BatchSize: 1,
+			OnError: func(err error, batch *pkg.Batch) {
+				errs <- err
+			},
+		},
+	})
+	signer := NewSigner([]byte("secret"))
+	handler := Redirect(client, signer, nil)
+	link, err := RedirectURL(signer, "https://example.com/out", "https://github.com")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://github.com", w.Header().Get("Location"))
+	assert.Error(t, <-errs)
+}
+
+func TestRedirectFuncs(t *testing.T) {
+	signer := NewSigner([]byte("secret"))
+	tpl := template.Must(template.New("").Funcs(RedirectFuncs(signer, "/out")).Parse(`<a href="{{trackedLink .}}">Link</a>`))
+	var out strings.Builder
+	assert.NoError(t, tpl.Execute(&out, "https://github.com/?a=1&b=2"))
+	link, err := RedirectURL(signer, "/out", "https://github.com/?a=1&b=2")
+	assert.NoError(t, err)
+	assert.Equal(t, `<a href="`+template.HTMLEscapeString(link)+`">Link</a>`, out.String())
+	assert.Error(t, tpl.Execute(&out, "javascript:alert(1)"))
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+)
+
+// SignatureParam is the query parameter holding the signature of a signed URL.
+const SignatureParam = "sig"
+
+// ErrInvalidSignature is returned if the signature of a URL is missing or doesn't match its query parameters.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer signs query parameters using HMAC-SHA256, so that they cannot be changed by third parties.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner creates a new Signer for given secret key.
+// The key should be at least 32 bytes long and must be kept secret.
+func NewSigner(key []byte) *Signer {
+	return &Signer{
+		key: key,
+	}
+}
+
+// Sign returns a copy of given query parameters including the signature.
+func (signer *Signer) Sign(values url.Values) url.Values {
+	signed := make(url.Values, len(values)+1)
+
+	for k, v := range values {
+		if k != SignatureParam {
+			signed[k] = v
+		}
+	}
+
+	signed.Set(SignatureParam, signer.signature(signed))
+	return signed
+}
+
+// Verify returns ErrInvalidSignature if the signature of given query parameters is missing or invalid.
+func (signer *Signer) Verify(values url.Values) error {
+	sig := values.Get(SignatureParam)
+
+	if sig == "" {
+		return ErrInvalidSignature
+	}
+
+	unsigned := make(url.Values, len(values))
+
+	for k, v := range values {
+		if k != SignatureParam {
+			unsigned[k] = v
+		}
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(signer.signature(unsigned))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// SignURL returns given URL with query parameters added and signed.
+// Existing query parameters of the URL are signed as well.
+func (signer *Signer) SignURL(rawURL string, values url.Values) (string, error) {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+
+	for k, v := range values {
+		query[k] = v
+	}
+
+	u.RawQuery = signer.Sign(query).Encode()
+	return u.String(), nil
+}
+
+func (signer *Signer) signature(values url.Values) string {
+	// Encode sorts the parameters by key, so the result doesn't depend on their order in the URL
+	mac := hmac.New(sha256.New, signer.key)
+	mac.Write([]byte(values.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
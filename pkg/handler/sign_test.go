@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner([]byte("secret"))
+	values := url.Values{"b": {"2"}, "a": {"1"}}
+	signed := signer.Sign(values)
+	assert.Empty(t, values.Get(SignatureParam))
+	assert.NotEmpty(t, signed.Get(SignatureParam))
+	assert.NoError(t, signer.Verify(signed))
+	signed.Set("a", "3")
+	assert.ErrorIs(t, signer.Verify(signed), ErrInvalidSignature)
+	assert.ErrorIs(t, signer.Verify(values), ErrInvalidSignature)
+	assert.ErrorIs(t, NewSigner([]byte("other")).Verify(signer.Sign(values)), ErrInvalidSignature)
+	signedURL, err := signer.SignURL("https://example.com/path?c=3", values)
+	assert.NoError(t, err)
+	u, err := url.Parse(signedURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "/path", u.Path)
+	assert.Equal(t, "3", u.Query().Get("c"))
+	assert.NoError(t, signer.Verify(u.Query()))
+}
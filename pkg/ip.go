@@ -0,0 +1,286 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// HeaderForwarded is the RFC 7239 Forwarded header.
+	HeaderForwarded = "Forwarded"
+
+	// HeaderXForwardedFor is the X-Forwarded-For header set by most proxies and load balancers.
+	HeaderXForwardedFor = "X-Forwarded-For"
+
+	// HeaderXRealIP is the X-Real-IP header set by nginx and others.
+	HeaderXRealIP = "X-Real-IP"
+
+	// HeaderCFConnectingIP is the CF-Connecting-IP header set by Cloudflare.
+	HeaderCFConnectingIP = "CF-Connecting-IP"
+
+	// HeaderTrueClientIP is the True-Client-IP header set by Cloudflare Enterprise and Akamai.
+	HeaderTrueClientIP = "True-Client-IP"
+
+	// HeaderXForwardedProto is the X-Forwarded-Proto header set by most proxies and load balancers terminating TLS.
+	HeaderXForwardedProto = "X-Forwarded-Proto"
+
+	// HeaderXForwardedHost is the X-Forwarded-Host header set by proxies forwarding requests to another host.
+	HeaderXForwardedHost = "X-Forwarded-Host"
+)
+
+// PrivateNetworks is a list of loopback and private network ranges, which can be trusted if the proxies run in the same network.
+var PrivateNetworks = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// IPResolver extracts the visitor IP address from a request.
+type IPResolver interface {
+	// ClientIP returns the visitor IP address for given request.
+	ClientIP(r *http.Request) string
+}
+
+// SchemeResolver can be implemented by an IPResolver to read the scheme (http or https) used by the visitor
+// from headers set by trusted proxies. It's used to build the absolute page URL for requests received by a server.
+type SchemeResolver interface {
+	// Scheme returns the scheme used by the visitor, or an empty string if unknown.
+	Scheme(r *http.Request) string
+}
+
+// HostResolver can be implemented by an IPResolver to read the host requested by the visitor
+// from headers set by trusted proxies. It's used to build the absolute page URL for requests received by a server.
+type HostResolver interface {
+	// Host returns the host requested by the visitor, or an empty string if unknown.
+	Host(r *http.Request) string
+}
+
+// RemoteAddrIPResolver is the default IPResolver, returning the http.Request.RemoteAddr without the port.
+type RemoteAddrIPResolver struct{}
+
+// ClientIP implements the IPResolver interface.
+func (resolver *RemoteAddrIPResolver) ClientIP(r *http.Request) string {
+	return stripPort(r.RemoteAddr)
+}
+
+// ProxyIPResolver is an IPResolver reading the visitor IP address from headers set by trusted proxies.
+// Headers are only read if the request comes from a trusted proxy, so that visitors cannot spoof their IP address.
+// X-Forwarded-For and Forwarded are walked from right to left and the first address not belonging to a trusted proxy is used.
+// It implements the SchemeResolver and HostResolver interfaces to read X-Forwarded-Proto and X-Forwarded-Host as well.
+type ProxyIPResolver struct {
+	trusted []netip.Prefix
+	headers []string
+}
+
+// NewProxyIPResolver creates a new ProxyIPResolver for given trusted proxy networks (in CIDR notation or single addresses)
+// and headers, which are checked in given order. X-Forwarded-For is used if no headers are passed.
+// Only pass headers your trusted proxies always set or overwrite, as proxies appending to X-Forwarded-For
+// usually pass a Forwarded header sent by the visitor through unchanged, and headers like CF-Connecting-IP or X-Real-IP are used as is.
+func NewProxyIPResolver(trustedProxies []string, headers ...string) (*ProxyIPResolver, error) {
+	trusted := make([]netip.Prefix, 0, len(trustedProxies))
+
+	for _, proxy := range trustedProxies {
+		var prefix netip.Prefix
+		var err error
+
+		if strings.Contains(proxy, "/") {
+			prefix, err = netip.ParsePrefix(proxy)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(proxy)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		trusted = append(trusted, prefix.Masked())
+	}
+
+	if len(headers) == 0 {
+		headers = []string{HeaderXForwardedFor}
+	}
+
+	return &ProxyIPResolver{
+		trusted: trusted,
+		headers: headers,
+	}, nil
+}
+
+// ClientIP implements the IPResolver interface.
+func (resolver *ProxyIPResolver) ClientIP(r *http.Request) string {
+	remoteAddr := stripPort(r.RemoteAddr)
+	remote, err := netip.ParseAddr(remoteAddr)
+
+	if err != nil || !resolver.isTrusted(remote) {
+		return remoteAddr
+	}
+
+	for _, header := range resolver.headers {
+		var ip netip.Addr
+
+		switch http.CanonicalHeaderKey(header) {
+		case HeaderForwarded:
+			ip = resolver.walkChain(parseForwarded(r.Header.Values(HeaderForwarded)))
+		case HeaderXForwardedFor:
+			ip = resolver.walkChain(parseXForwardedFor(r.Header.Values(HeaderXForwardedFor)))
+		default:
+			ip = parseIP(r.Header.Get(header))
+		}
+
+		if ip.IsValid() {
+			return ip.String()
+		}
+	}
+
+	return remoteAddr
+}
+
+// walkChain returns the rightmost address not belonging to a trusted proxy.
+// The leftmost address is returned if all addresses are trusted.
+// The walk stops at invalid entries, as everything left of them cannot be trusted.
+func (resolver *ProxyIPResolver) walkChain(chain []string) netip.Addr {
+	var ip netip.Addr
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr := parseIP(chain[i])
+
+		if !addr.IsValid() {
+			break
+		}
+
+		ip = addr
+
+		if !resolver.isTrusted(addr) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// Scheme implements the SchemeResolver interface.
+// The X-Forwarded-Proto header is only read if the request comes from a trusted proxy.
+func (resolver *ProxyIPResolver) Scheme(r *http.Request) string {
+	if !resolver.isTrustedRemote(r) {
+		return ""
+	}
+
+	// only the rightmost value has been set by the trusted proxy, like in walkChain, as the others might have been sent by the visitor
+	scheme := strings.ToLower(lastHeaderValue(r, HeaderXForwardedProto))
+
+	if scheme != "http" && scheme != "https" {
+		return ""
+	}
+
+	return scheme
+}
+
+// Host implements the HostResolver interface.
+// The X-Forwarded-Host header is only read if the request comes from a trusted proxy.
+func (resolver *ProxyIPResolver) Host(r *http.Request) string {
+	if !resolver.isTrustedRemote(r) {
+		return ""
+	}
+
+	host := lastHeaderValue(r, HeaderXForwardedHost)
+
+	if strings.ContainsAny(host, "/?#@\\ ") {
+		return ""
+	}
+
+	return host
+}
+
+func (resolver *ProxyIPResolver) isTrustedRemote(r *http.Request) bool {
+	remote, err := netip.ParseAddr(stripPort(r.RemoteAddr))
+	return err == nil && resolver.isTrusted(remote)
+}
+
+func (resolver *ProxyIPResolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range resolver.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastHeaderValue returns the rightmost comma-separated value of given header.
+func lastHeaderValue(r *http.Request, header string) string {
+	values := r.Header.Values(header)
+
+	if len(values) == 0 {
+		return ""
+	}
+
+	value := values[len(values)-1]
+
+	if i := strings.LastIndex(value, ","); i >= 0 {
+		value = value[i+1:]
+	}
+
+	return strings.TrimSpace(value)
+}
+
+func parseXForwardedFor(values []string) []string {
+	chain := make([]string, 0)
+
+	for _, value := range values {
+		for _, ip := range strings.Split(value, ",") {
+			chain = append(chain, strings.TrimSpace(ip))
+		}
+	}
+
+	return chain
+}
+
+func parseForwarded(values []string) []string {
+	chain := make([]string, 0)
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			forwardedFor := ""
+
+			for _, pair := range strings.Split(element, ";") {
+				k, v, found := strings.Cut(strings.TrimSpace(pair), "=")
+
+				if found && strings.EqualFold(k, "for") {
+					forwardedFor = strings.Trim(v, `"`)
+				}
+			}
+
+			// elements without a for parameter are kept to stop the walk, as the address is unknown
+			chain = append(chain, forwardedFor)
+		}
+	}
+
+	return chain
+}
+
+func parseIP(ip string) netip.Addr {
+	addr, err := netip.ParseAddr(stripPort(strings.TrimSpace(ip)))
+
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addr.Unmap().WithZone("")
+}
+
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
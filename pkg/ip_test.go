@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteAddrIPResolver(t *testing.T) {
+	input := []struct {
+		remoteAddr string
+		ip         string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"[2001:db8::1]:1234", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+	}
+	resolver := new(RemoteAddrIPResolver)
+
+	for _, in := range input {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = in.remoteAddr
+		assert.Equal(t, in.ip, resolver.ClientIP(req))
+	}
+}
+
+func TestProxyIPResolver(t *testing.T) {
+	defaultResolver, err := NewProxyIPResolver([]string{"10.0.0.0/8", "203.0.113.7"})
+	assert.NoError(t, err)
+	forwardedResolver, err := NewProxyIPResolver([]string{"10.0.0.0/8"}, HeaderForwarded, HeaderXForwardedFor)
+	assert.NoError(t, err)
+	cloudflareResolver, err := NewProxyIPResolver([]string{"10.0.0.0/8"}, HeaderCFConnectingIP, HeaderXForwardedFor)
+	assert.NoError(t, err)
+	realIPResolver, err := NewProxyIPResolver(PrivateNetworks, HeaderXRealIP, HeaderTrueClientIP)
+	assert.NoError(t, err)
+	input := []struct {
+		name       string
+		resolver   *ProxyIPResolver
+		remoteAddr string
+		header     map[string]string
+		ip         string
+	}{
+		{"no proxy", defaultResolver, "198.51.100.1:1234", nil, "198.51.100.1"},
+		{"untrusted remote spoofing X-Forwarded-For", defaultResolver, "198.51.100.1:1234", map[string]string{"X-Forwarded-For": "192.0.2.1"}, "198.51.100.1"},
+		{"untrusted remote spoofing Forwarded", forwardedResolver, "198.51.100.1:1234", map[string]string{"Forwarded": "for=192.0.2.1"}, "198.51.100.1"},
+		{"trusted proxy", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.0.2.1"}, "192.0.2.1"},
+		{"trusted proxy without header", defaultResolver, "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"spoofed entry left of client", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 192.0.2.1"}, "192.0.2.1"},
+		{"proxy chain", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 192.0.2.1, 203.0.113.7, 10.0.0.2"}, "192.0.2.1"},
+		{"all trusted", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"invalid entry", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"port in X-Forwarded-For", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.0.2.1:5678"}, "192.0.2.1"},
+		{"IPv6 in X-Forwarded-For", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "2001:db8::1"}, "2001:db8::1"},
+		{"Forwarded", forwardedResolver, "10.0.0.1:1234", map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2`}, "2001:db8:cafe::17"},
+		{"Forwarded before X-Forwarded-For", forwardedResolver, "10.0.0.1:1234", map[string]string{"Forwarded": "for=192.0.2.1", "X-Forwarded-For": "192.0.2.2"}, "192.0.2.1"},
+		{"Forwarded unknown", forwardedResolver, "10.0.0.1:1234", map[string]string{"Forwarded": "for=unknown", "X-Forwarded-For": "192.0.2.2"}, "192.0.2.2"},
+		{"client spoofing Forwarded through proxy appending X-Forwarded-For", defaultResolver, "10.0.0.1:1234", map[string]string{"Forwarded": "for=6.6.6.6", "X-Forwarded-For": "1.2.3.4"}, "1.2.3.4"},
+		{"client spoofing Forwarded without X-Forwarded-For", defaultResolver, "10.0.0.1:1234", map[string]string{"Forwarded": "for=6.6.6.6"}, "10.0.0.1"},
+		{"CF-Connecting-IP", cloudflareResolver, "10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "192.0.2.1", "X-Forwarded-For": "192.0.2.2"}, "192.0.2.1"},
+		{"CF-Connecting-IP from untrusted remote", cloudflareResolver, "198.51.100.1:1234", map[string]string{"CF-Connecting-IP": "192.0.2.1"}, "198.51.100.1"},
+		{"invalid CF-Connecting-IP", cloudflareResolver, "10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "invalid", "X-Forwarded-For": "192.0.2.2"}, "192.0.2.2"},
+		{"X-Real-IP", realIPResolver, "127.0.0.1:1234", map[string]string{"X-Real-IP": "192.0.2.1"}, "192.0.2.1"},
+		{"True-Client-IP", realIPResolver, "[::1]:1234", map[string]string{"True-Client-IP": "192.0.2.1"}, "192.0.2.1"},
+		{"X-Real-IP ignored by default", defaultResolver, "10.0.0.1:1234", map[string]string{"X-Real-IP": "192.0.2.1"}, "10.0.0.1"},
+	}
+
+	for _, in := range input {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = in.remoteAddr
+
+		for k, v := range in.header {
+			req.Header.Set(k, v)
+		}
+
+		assert.Equal(t, in.ip, in.resolver.ClientIP(req), in.name)
+	}
+}
+
+func TestNewProxyIPResolver(t *testing.T) {
+	_, err := NewProxyIPResolver([]string{"invalid"})
+	assert.Error(t, err)
+	_, err = NewProxyIPResolver([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+func TestProxyIPResolverScheme(t *testing.T) {
+	resolver, err := NewProxyIPResolver([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	input := []struct {
+		remoteAddr string
+		proto      string
+		scheme     string
+	}{
+		{"10.0.0.1:1234", "https", "https"},
+		{"10.0.0.1:1234", "HTTP", "http"},
+		{"10.0.0.1:1234", "https, http", "http"},
+		{"10.0.0.1:1234", "http, https", "https"},
+		{"10.0.0.1:1234", "ftp", ""},
+		{"10.0.0.1:1234", "", ""},
+		{"198.51.100.1:1234", "https", ""},
+	}
+
+	for _, in := range input {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = in.remoteAddr
+		req.Header.Set("X-Forwarded-Proto", in.proto)
+		assert.Equal(t, in.scheme, resolver.Scheme(req), in.remoteAddr+" "+in.proto)
+	}
+}
+
+func TestProxyIPResolverHost(t *testing.T) {
+	resolver, err := NewProxyIPResolver([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	input := []struct {
+		remoteAddr string
+		host       string
+		expected   string
+	}{
+		{"10.0.0.1:1234", "example.com", "example.com"},
+		{"10.0.0.1:1234", "example.com:8080", "example.com:8080"},
+		{"10.0.0.1:1234", "spoofed.com, example.com", "example.com"},
+		{"10.0.0.1:1234", "evil.com/path", ""},
+		{"10.0.0.1:1234", "user@evil.com", ""},
+		{"10.0.0.1:1234", "", ""},
+		{"198.51.100.1:1234", "example.com", ""},
+	}
+
+	for _, in := range input {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = in.remoteAddr
+		req.Header.Set("X-Forwarded-Host", in.host)
+		assert.Equal(t, in.expected, resolver.Host(req), in.remoteAddr+" "+in.host)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !unix
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// lockFile acquires an exclusive lock by creating given file exclusively.
+// Lock files older than lockFileStaleAfter are considered stale and removed, in case a process crashed while holding the lock.
+// The returned function releases the lock.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+
+		if err == nil {
+			_ = f.Close()
+			return func() {
+				_ = os.Remove(path)
+			}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockFileStaleAfter {
+			_ = os.Remove(path)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockFileRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package pkg
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockFile acquires an exclusive lock on given file, creating it if necessary.
+// The returned function releases the lock.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+
+		if err == nil {
+			break
+		}
+
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			_ = f.Close()
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockFileRetryInterval):
+		}
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// NotFoundEvent is the default event name for requests answered with status code 404.
+	NotFoundEvent = "404"
+
+	// ServerErrorEvent is the default event name for requests answered with a 5xx status code.
+	ServerErrorEvent = "server_error"
+
+	defaultErrorRateLimit = time.Minute
+	defaultErrorMaxPaths  = 10_000
+)
+
+// ErrorOptions configures the error tracking middleware.
+type ErrorOptions struct {
+	// NotFoundEvent is the event name used for status code 404. NotFoundEvent by default.
+	NotFoundEvent string
+
+	// ServerErrorEvent is the event name used for 5xx status codes. ServerErrorEvent by default.
+	ServerErrorEvent string
+
+	// SkipPaths is a list of glob patterns as used by path.Match. Requests matching any of them are not tracked.
+	SkipPaths []string
+
+	// RateLimit is the minimum time between two events for the same path and status code. One minute by default.
+	RateLimit time.Duration
+
+	// MaxPaths is the maximum number of paths remembered for rate limiting. 10,000 by default.
+	// Events for new paths are dropped while the limit is reached.
+	MaxPaths int
+
+	// Tracker is an optional AsyncTracker used to queue events. pkg.Client.DefaultTracker is used if not set.
+	Tracker *pkg.AsyncTracker
+
+	// OnError is called if an event could not be queued. Errors are ignored if not set.
+	// Errors sending queued events are reported by the AsyncTracker.
+	OnError func(r *http.Request, err error)
+}
+
+// Errors returns a http.Handler sending an event for requests to next answered with status code 404 or a 5xx status code,
+// so that broken links and server errors show up in the dashboard.
+// The event metadata includes the requested path, the referrer, and the status code.
+// Metadata values longer than pkg.MaxValueLength are truncated.
+// Events are rate limited per path, so that crawlers requesting many missing pages don't flood the API.
+// Errors can be combined with Handler, which only tracks successful requests as page views.
+func Errors(client *pkg.Client, next http.Handler, options *ErrorOptions) http.Handler {
+	if options == nil {
+		options = new(ErrorOptions)
+	}
+
+	notFoundEvent := options.NotFoundEvent
+	serverErrorEvent := options.ServerErrorEvent
+
+	if notFoundEvent == "" {
+		notFoundEvent = NotFoundEvent
+	}
+
+	if serverErrorEvent == "" {
+		serverErrorEvent = ServerErrorEvent
+	}
+
+	tracker := options.Tracker
+
+	if tracker == nil {
+		tracker = client.DefaultTracker()
+	}
+
+	limiter := newPathLimiter(options.RateLimit, options.MaxPaths)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		status := sw.status()
+		var name string
+
+		if status == http.StatusNotFound {
+			name = notFoundEvent
+		} else if status >= http.StatusInternalServerError {
+			name = serverErrorEvent
+		} else {
+			return
+		}
+
+		for _, pattern := range options.SkipPaths {
+			if match, _ := path.Match(pattern, r.URL.Path); match {
+				return
+			}
+		}
+
+		if !limiter.allow(strconv.Itoa(status) + " " + r.URL.Path) {
+			return
+		}
+
+		// metadata values are truncated, so that long paths and referrers don't cause the event to be rejected
+		meta := map[string]string{
+			"path":   pkg.TruncateValue(r.URL.Path),
+			"status": strconv.Itoa(status),
+		}
+
+		if referrer := client.ReferrerFromRequest(r); referrer != "" {
+			meta["referrer"] = pkg.TruncateValue(referrer)
+		}
+
+		if err := tracker.Event(name, 0, meta, r, nil); err != nil && options.OnError != nil {
+			options.OnError(r, err)
+		}
+	})
+}
+
+// pathLimiter allows one event per key and interval.
+type pathLimiter struct {
+	interval time.Duration
+	maxPaths int
+	sent     map[string]time.Time
+	m        sync.Mutex
+}
+
+func newPathLimiter(interval time.Duration, maxPaths int) *pathLimiter {
+	if interval <= 0 {
+		interval = defaultErrorRateLimit
+	}
+
+	if maxPaths <= 0 {
+		maxPaths = defaultErrorMaxPaths
+	}
+
+	return &pathLimiter{
+		interval: interval,
+		maxPaths: maxPaths,
+		sent:     make(map[string]time.Time),
+	}
+}
+
+func (limiter *pathLimiter) allow(key string) bool {
+	limiter.m.Lock()
+	defer limiter.m.Unlock()
+	now := time.Now()
+
+	if sent, ok := limiter.sent[key]; ok && now.Sub(sent) < limiter.interval {
+		return false
+	}
+
+	if len(limiter.sent) >= limiter.maxPaths {
+		for k, sent := range limiter.sent {
+			if now.Sub(sent) >= limiter.interval {
+				delete(limiter.sent, k)
+			}
+		}
+
+		if len(limiter.sent) >= limiter.maxPaths {
+			return false
+		}
+	}
+
+	limiter.sent[key] = now
+	return true
+}
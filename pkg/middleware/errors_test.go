@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	events := make(chan pkg.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []pkg.BatchEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+		for _, event := range batch {
+			events <- event.Event
+		}
+	}))
+	defer server.Close()
+	client := pkg.NewClient("", "secret", &pkg.ClientConfig{
+		BaseURL: server.URL,
+		DefaultTracker: &pkg.AsyncTrackerConfig{
+			BatchSize: 1,
+		},
+	})
+	handler := Errors(client, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+
+		if status == 0 {
+			status = http.StatusNotFound
+		}
+
+		w.WriteHeader(status)
+	}), &ErrorOptions{
+		SkipPaths: []string{"/wp-*"},
+	})
+	input := []struct {
+		url      string
+		referrer string
+		name     string
+		status   string
+	}{
+		{"/old-post", "https://news.ycombinator.com/", NotFoundEvent, "404"},
+		{"/old-post", "", "", ""},
+		{"/old-post?status=500", "", ServerErrorEvent, "500"},
+		{"/broken?status=502&ref=newsletter", "", ServerErrorEvent, "502"},
+		{"/page?status=200", "", "", ""},
+		{"/wp-login.php", "", "", ""},
+		{"/" + strings.Repeat("a", pkg.MaxValueLength), "https://example.com/" + strings.Repeat("r", pkg.MaxValueLength), NotFoundEvent, "404"},
+	}
+
+	for _, in := range input {
+		req := httptest.NewRequest(http.MethodGet, in.url, nil)
+
+		if in.referrer != "" {
+			req.Header.Set("Referer", in.referrer)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if in.name == "" {
+			select {
+			case event := <-events:
+				t.Fatalf("unexpected event for %s: %v", in.url, event)
+			case <-time.After(time.Millisecond * 100):
+			}
+
+			continue
+		}
+
+		select {
+		case event := <-events:
+			assert.Equal(t, in.name, event.Name)
+			assert.Equal(t, pkg.TruncateValue(req.URL.Path), event.Metadata["path"])
+			assert.Equal(t, in.status, event.Metadata["status"])
+			assert.Equal(t, pkg.TruncateValue(client.ReferrerFromRequest(req)), event.Metadata["referrer"])
+		case <-time.After(time.Second):
+			t.Fatalf("event for %s not received", in.url)
+		}
+	}
+}
+
+func TestPathLimiter(t *testing.T) {
+	limiter := newPathLimiter(time.Millisecond*50, 2)
+	assert.True(t, limiter.allow("/a"))
+	assert.False(t, limiter.allow("/a"))
+	assert.True(t, limiter.allow("/b"))
+	assert.False(t, limiter.allow("/c"))
+	time.Sleep(time.Millisecond * 60)
+	assert.True(t, limiter.allow("/c"))
+	assert.True(t, limiter.allow("/a"))
+	assert.Len(t, limiter.sent, 2)
+}
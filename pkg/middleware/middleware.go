@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"bufio"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// DefaultStaticExtensions is the list of file extensions that are not tracked by default.
+var DefaultStaticExtensions = []string{
+	".css",
+	".js",
+	".mjs",
+	".map",
+	".png",
+	".jpg",
+	".jpeg",
+	".gif",
+	".svg",
+	".ico",
+	".webp",
+	".avif",
+	".woff",
+	".woff2",
+	".ttf",
+	".otf",
+	".eot",
+	".mp4",
+	".webm",
+	".mp3",
+	".pdf",
+	".zip",
+}
+
+// Options configures the tracking middleware.
+type Options struct {
+	// SkipPaths is a list of glob patterns as used by path.Match. Requests matching any of them are not tracked.
+	SkipPaths []string
+
+	// StaticExtensions is a list of file extensions (including the dot) that are not tracked.
+	// DefaultStaticExtensions is used if not set. Set it to an empty, non-nil slice to track all files.
+	StaticExtensions []string
+
+	// PageViewOptions is an optional callback returning per-request options, like the title or tags.
+	// It is called after the response has been written.
+	PageViewOptions func(r *http.Request) *pkg.PageViewOptions
+
+	// Tracker is an optional AsyncTracker used to queue page views. pkg.Client.DefaultTracker is used if not set.
+	// Don't use an AsyncTracker configured with pkg.OverflowBlock, as it holds the request until there is room in the queue.
+	Tracker *pkg.AsyncTracker
+
+	// OnError is called if a page view could not be queued. Errors are ignored if not set.
+	// Errors sending queued page views are reported by the AsyncTracker.
+	// Page views filtered by the pkg.BotFilter are reported as pkg.ErrFilteredBot, speculative loads as pkg.ErrSpeculativeLoad,
+	// and partial requests as pkg.ErrPartialRequest.
+	OnError func(r *http.Request, err error)
+}
+
+// ClientHints returns a http.Handler requesting the pkg.ClientHints read by the pkg.Client for all responses of next.
+// See pkg.SetClientHintsHeaders for details.
+func ClientHints(next http.Handler, critical bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pkg.SetClientHintsHeaders(w, critical)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler returns a http.Handler tracking page views for next.
+// Page views are queued after the response has been written and flushed and sent in the background, so tracking doesn't add latency to the response.
+// Only successful (2xx) GET and HEAD requests are tracked, excluding static files and paths matching Options.SkipPaths.
+func Handler(client *pkg.Client, next http.Handler, options *Options) http.Handler {
+	if options == nil {
+		options = new(Options)
+	}
+
+	staticExtensions := options.StaticExtensions
+
+	if staticExtensions == nil {
+		staticExtensions = DefaultStaticExtensions
+	}
+
+	tracker := options.Tracker
+
+	if tracker == nil {
+		tracker = client.DefaultTracker()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if !trackRequest(r, sw.status(), options.SkipPaths, staticExtensions) {
+			return
+		}
+
+		// send the buffered response to the client before the page view is queued
+		_ = http.NewResponseController(sw).Flush()
+		var pageViewOptions *pkg.PageViewOptions
+
+		if options.PageViewOptions != nil {
+			pageViewOptions = options.PageViewOptions(r)
+		}
+
+		if err := tracker.PageView(r, pageViewOptions); err != nil && options.OnError != nil {
+			options.OnError(r, err)
+		}
+	})
+}
+
+func trackRequest(r *http.Request, status int, skipPaths, staticExtensions []string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return false
+	}
+
+	ext := strings.ToLower(path.Ext(r.URL.Path))
+
+	for _, staticExt := range staticExtensions {
+		if ext == staticExt {
+			return false
+		}
+	}
+
+	for _, pattern := range skipPaths {
+		if match, _ := path.Match(pattern, r.URL.Path); match {
+			return false
+		}
+	}
+
+	return true
+}
+
+// statusWriter records the status code written to the http.ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface.
+func (w *statusWriter) Flush() {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface, e.g. for WebSocket connections.
+// Hijacked requests are recorded with status code 101 (Switching Protocols), so they are not tracked.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+
+	return hijacker.Hijack()
+}
+
+// ReadFrom implements the io.ReaderFrom interface, so that the underlying http.ResponseWriter can copy files efficiently.
+func (w *statusWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	return io.Copy(w.ResponseWriter, r)
+}
+
+// Unwrap returns the underlying http.ResponseWriter for use with http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusWriter) status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+
+	return w.statusCode
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/pirsch-analytics/pirsch-go-sdk/v2/pkg"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	hits := make(chan pkg.PageView, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var views []pkg.BatchPageView
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&views))
+
+		for _, view := range views {
+			hits <- view.PageView
+		}
+	}))
+	defer server.Close()
+	client := pkg.NewClient("", "secret", &pkg.ClientConfig{
+		BaseURL: server.URL,
+		DefaultTracker: &pkg.AsyncTrackerConfig{
+			BatchSize: 1,
+		},
+	})
+	handler := Handler(client, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}), &Options{
+		SkipPaths: []string{"/admin/*"},
+		PageViewOptions: func(r *http.Request) *pkg.PageViewOptions {
+			return &pkg.PageViewOptions{
+				Title: "Title " + r.URL.Path,
+			}
+		},
+	})
+	input := []struct {
+		method string
+		path   string
+		track  bool
+	}{
+		{http.MethodGet, "/", true},
+		{http.MethodHead, "/page", true},
+		{http.MethodPost, "/form", false},
+		{http.MethodGet, "/missing", false},
+		{http.MethodGet, "/static/style.css", false},
+		{http.MethodGet, "/admin/settings", false},
+	}
+
+	for _, in := range input {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(in.method, "https://example.com"+in.path, nil))
+		assert.Equal(t, in.track, rec.Flushed)
+
+		if in.track {
+			select {
+			case hit := <-hits:
+				assert.Equal(t, "https://example.com"+in.path, hit.URL)
+				assert.Equal(t, "Title "+in.path, hit.Title)
+			case <-time.After(time.Second):
+				t.Fatalf("page view for %s not tracked", in.path)
+			}
+		}
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	assert.Empty(t, hits)
+}
+
+func TestHandlerHijack(t *testing.T) {
+	client := pkg.NewClient("", "secret", &pkg.ClientConfig{
+		BaseURL: "http://127.0.0.1:0",
+	})
+	server := httptest.NewServer(Handler(client, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(io.ReaderFrom)
+		assert.True(t, ok)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		_ = rw.Flush()
+		_ = conn.Close()
+	}), nil))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	_ = resp.Body.Close()
+}
+
+func TestClientHints(t *testing.T) {
+	handler := ClientHints(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}), true)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Contains(t, w.Header().Get("Accept-CH"), "Sec-CH-UA-Platform-Version")
+	assert.Contains(t, w.Header().Get("Critical-CH"), "Sec-CH-UA-Platform-Version")
+	assert.Contains(t, w.Header().Get("Permissions-Policy"), "ch-ua-platform-version=(self)")
+}
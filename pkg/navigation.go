@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrSpeculativeLoad is returned if a page view has not been sent because the request is a speculative load (prefetch or prerender).
+	ErrSpeculativeLoad = errors.New("speculative load")
+
+	// ErrPartialRequest is returned if a page view has not been sent because the request loads part of a page (HTMX or Turbo Frames).
+	ErrPartialRequest = errors.New("partial request")
+)
+
+// SpeculativeLoadPolicy decides how page views for speculative loads (prefetch or prerender) are handled.
+// Browsers mark them with the Sec-Purpose, Purpose, X-Purpose, or X-Moz headers.
+type SpeculativeLoadPolicy int
+
+const (
+	// SpeculativeLoadSkip does not send page views for speculative loads and returns ErrSpeculativeLoad.
+	SpeculativeLoadSkip SpeculativeLoadPolicy = iota
+
+	// SpeculativeLoadTrack sends page views for speculative loads like for any other request.
+	SpeculativeLoadTrack
+
+	// SpeculativeLoadDefer passes page views for speculative loads to ClientConfig.OnSpeculativeLoad instead of sending them
+	// and returns ErrSpeculativeLoad. They can be sent later using Client.PageViewBatch, once the page has actually been visited.
+	SpeculativeLoadDefer
+)
+
+// PartialRequestPolicy decides how page views for partial requests are handled.
+// Partial requests load part of the current page using HTMX (hx-get, hx-trigger, polling, ...) or Turbo Frames
+// and are sent in addition to the page view for the page itself.
+// Boosted HTMX requests, HTMX history restores, and Turbo Frame requests advancing the browser history are navigations
+// to a new page and always tracked.
+type PartialRequestPolicy int
+
+const (
+	// PartialRequestSkip does not send page views for partial requests and returns ErrPartialRequest.
+	PartialRequestSkip PartialRequestPolicy = iota
+
+	// PartialRequestTrack sends page views for partial requests attributed to the page they have been sent from.
+	PartialRequestTrack
+)
+
+// isSpeculativeLoad returns whether the request has been sent by the browser to prefetch or prerender a page.
+func isSpeculativeLoad(r *http.Request) bool {
+	for _, header := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(r.Header.Get(header))
+
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "prerender") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPartialRequest returns whether the request loads part of the current page using HTMX or Turbo Frames,
+// rather than navigating to a new page.
+func isPartialRequest(r *http.Request) bool {
+	if r.Header.Get("HX-Request") == "true" {
+		return r.Header.Get("HX-Boosted") != "true" && r.Header.Get("HX-History-Restore-Request") != "true"
+	}
+
+	if r.Header.Get("Turbo-Frame") != "" {
+		return r.Header.Get("Turbo-Action") != "advance"
+	}
+
+	return false
+}
+
+// getPartialURL returns the URL of the page a partial request has been sent from,
+// as the page view, event, or session belongs to the page the visitor is on, and not to the URL of the partial.
+// An empty string is returned for navigations and full page loads.
+func getPartialURL(r *http.Request) string {
+	if !isPartialRequest(r) {
+		return ""
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		return r.Header.Get("HX-Current-URL")
+	}
+
+	return r.Header.Get("Referer")
+}
+
+// getNavigationReferrer returns the URL of the page a boosted HTMX navigation has been sent from.
+// An empty string is returned for all other requests.
+func getNavigationReferrer(r *http.Request) string {
+	if r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") == "true" {
+		return r.Header.Get("HX-Current-URL")
+	}
+
+	return ""
+}
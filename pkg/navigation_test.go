@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestIsSpeculativeLoad(t *testing.T) {
+	input := []struct {
+		header      string
+		value       string
+		speculative bool
+	}{
+		{"Sec-Purpose", "prefetch", true},
+		{"Sec-Purpose", "prefetch;prerender", true},
+		{"Sec-Purpose", "prefetch;anonymous-client-ip", true},
+		{"Purpose", "prefetch", true},
+		{"X-Purpose", "preview", true},
+		{"X-Moz", "prefetch", true},
+		{"Sec-Fetch-Mode", "navigate", false},
+	}
+
+	for _, in := range input {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(in.header, in.value)
+		assert.Equal(t, in.speculative, isSpeculativeLoad(req), in.header+": "+in.value)
+	}
+}
+
+func TestIsPartialRequest(t *testing.T) {
+	input := []struct {
+		header  map[string]string
+		partial bool
+	}{
+		{nil, false},
+		{map[string]string{"HX-Request": "true"}, true},
+		{map[string]string{"HX-Request": "true", "HX-Trigger": "load"}, true},
+		{map[string]string{"HX-Request": "true", "HX-Boosted": "true"}, false},
+		{map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"}, false},
+		{map[string]string{"Turbo-Frame": "cart"}, true},
+		{map[string]string{"Turbo-Frame": "cart", "Turbo-Action": "replace"}, true},
+		{map[string]string{"Turbo-Frame": "cart", "Turbo-Action": "advance"}, false},
+	}
+
+	for _, in := range input {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		for k, v := range in.header {
+			req.Header.Set(k, v)
+		}
+
+		assert.Equal(t, in.partial, isPartialRequest(req), in.header)
+	}
+}
+
+func TestClientPartialNavigation(t *testing.T) {
+	client := NewClient("", "secret", nil)
+
+	// plain partials are skipped, but events and sessions belong to the current page
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/partials/list", nil)
+	req.Header.Set("Referer", "https://example.com/products")
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Current-URL", "https://example.com/products")
+	assert.ErrorIs(t, client.PageView(req, nil), ErrPartialRequest)
+	assert.ErrorIs(t, client.handlePartialRequest(req), ErrPartialRequest)
+	event := client.getEventData("event", 0, nil, req, new(PageViewOptions))
+	assert.Equal(t, "https://example.com/products", event.URL)
+	assert.Equal(t, "https://example.com/products", client.getSessionData(req, new(PageViewOptions)).URL)
+
+	// boosted requests are navigations from the current page
+	req.Header.Set("HX-Boosted", "true")
+	req.Header.Set("Referer", "https://example.com/")
+	assert.NoError(t, client.handlePartialRequest(req))
+	hit := client.getPageViewData(req, new(PageViewOptions))
+	assert.Equal(t, "https://example.com/partials/list", hit.URL)
+	assert.Equal(t, "https://example.com/products", hit.Referrer)
+
+	// history restores are navigations too
+	req.Header.Del("HX-Boosted")
+	req.Header.Set("HX-History-Restore-Request", "true")
+	assert.NoError(t, client.handlePartialRequest(req))
+	hit = client.getPageViewData(req, new(PageViewOptions))
+	assert.Equal(t, "https://example.com/partials/list", hit.URL)
+	assert.Equal(t, "https://example.com/", hit.Referrer)
+
+	// Turbo Frames are only tracked if they advance the browser history
+	req = httptest.NewRequest(http.MethodGet, "https://example.com/frames/cart", nil)
+	req.Header.Set("Referer", "https://example.com/checkout")
+	req.Header.Set("Turbo-Frame", "cart")
+	assert.ErrorIs(t, client.PageView(req, nil), ErrPartialRequest)
+	req.Header.Set("Turbo-Action", "advance")
+	assert.NoError(t, client.handlePartialRequest(req))
+	hit = client.getPageViewData(req, &PageViewOptions{Referrer: "https://google.com"})
+	assert.Equal(t, "https://example.com/frames/cart", hit.URL)
+	assert.Equal(t, "https://google.com", hit.Referrer)
+
+	// partials can be tracked as page views of the current page
+	client = NewClient("", "secret", &ClientConfig{PartialRequests: PartialRequestTrack})
+	req.Header.Del("Turbo-Action")
+	assert.NoError(t, client.handlePartialRequest(req))
+	hit = client.getPageViewData(req, new(PageViewOptions))
+	assert.Equal(t, "https://example.com/checkout", hit.URL)
+	assert.Empty(t, hit.Referrer)
+}
+
+func TestClientSpeculativeLoad(t *testing.T) {
+	var m sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hit PageView
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&hit))
+		m.Lock()
+		received = append(received, hit.URL)
+		m.Unlock()
+	}))
+	defer server.Close()
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.Header.Set("Sec-Purpose", "prefetch")
+	client := NewClient("", "secret", &ClientConfig{BaseURL: server.URL})
+	assert.ErrorIs(t, client.PageView(req, nil), ErrSpeculativeLoad)
+	var deferred []BatchPageView
+	client = NewClient("", "secret", &ClientConfig{
+		BaseURL:          server.URL,
+		SpeculativeLoads: SpeculativeLoadDefer,
+		OnSpeculativeLoad: func(r *http.Request, view BatchPageView) {
+			deferred = append(deferred, view)
+		},
+	})
+	assert.ErrorIs(t, client.PageView(req, nil), ErrSpeculativeLoad)
+	assert.Len(t, deferred, 1)
+	assert.Equal(t, "https://example.com/", deferred[0].URL)
+	assert.False(t, deferred[0].Time.IsZero())
+	client = NewClient("", "secret", &ClientConfig{
+		BaseURL:          server.URL,
+		SpeculativeLoads: SpeculativeLoadTrack,
+	})
+	assert.NoError(t, client.PageView(req, nil))
+	m.Lock()
+	defer m.Unlock()
+	assert.Equal(t, []string{"https://example.com/"}, received)
+}
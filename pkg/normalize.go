@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// URLRewriteRule replaces all matches of a regular expression in the URL path.
+type URLRewriteRule struct {
+	// Pattern is the regular expression as used by regexp.Compile.
+	Pattern string
+
+	// Replacement is the replacement as used by regexp.Regexp.ReplaceAllString.
+	Replacement string
+}
+
+// URLNormalizerConfig is used to configure the URLNormalizer.
+// The path is rewritten using the route pattern first, followed by the Rules and the Func.
+type URLNormalizerConfig struct {
+	// UseRoutePattern replaces the path with the route pattern matched by the http.ServeMux (http.Request.Pattern),
+	// like /users/{id}/orders/{oid}. Patterns without wildcards are ignored, as they match the path or any path below it.
+	UseRoutePattern bool
+
+	// Rules is a list of regular expressions applied to the path in order.
+	Rules []URLRewriteRule
+
+	// Func is an optional callback returning the new path for given request and path.
+	// The request is nil for URLs tracked without a request, like the URL passed to Client.TrackPageView.
+	Func func(r *http.Request, path string) string
+
+	// PatternTag is an optional tag key. The route pattern is added as a tag to page views and events if set.
+	PatternTag string
+}
+
+// URLNormalizer rewrites the path of page URLs before they are sent to Pirsch,
+// so that paths containing IDs or other high-cardinality values are grouped in the statistics.
+// The query parameters are kept.
+type URLNormalizer struct {
+	useRoutePattern bool
+	rules           []urlRewriteRule
+	fn              func(*http.Request, string) string
+	patternTag      string
+}
+
+type urlRewriteRule struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// NewURLNormalizer creates a new URLNormalizer for given configuration.
+func NewURLNormalizer(config *URLNormalizerConfig) (*URLNormalizer, error) {
+	if config == nil {
+		config = new(URLNormalizerConfig)
+	}
+
+	rules := make([]urlRewriteRule, 0, len(config.Rules))
+
+	for _, rule := range config.Rules {
+		regex, err := regexp.Compile(rule.Pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, urlRewriteRule{
+			regex:       regex,
+			replacement: rule.Replacement,
+		})
+	}
+
+	return &URLNormalizer{
+		useRoutePattern: config.UseRoutePattern,
+		rules:           rules,
+		fn:              config.Func,
+		patternTag:      config.PatternTag,
+	}, nil
+}
+
+// Normalize returns the normalized URL for given optional request and URL.
+// The route pattern is only used if the URL has the same path as the request,
+// as the page URL might have been set explicitly or read from a header.
+// The URL is returned unchanged if it cannot be parsed.
+func (normalizer *URLNormalizer) Normalize(r *http.Request, rawURL string) string {
+	normalized, _ := normalizer.normalize(r, rawURL)
+	return normalized
+}
+
+// normalize returns the normalized URL and the route pattern matching the URL.
+func (normalizer *URLNormalizer) normalize(r *http.Request, rawURL string) (string, string) {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return rawURL, ""
+	}
+
+	p := u.Path
+	var pattern string
+
+	if r != nil && p == r.URL.Path {
+		pattern = routePattern(r)
+	}
+
+	if normalizer.useRoutePattern && strings.Contains(pattern, "{") {
+		p = pattern
+	}
+
+	for _, rule := range normalizer.rules {
+		p = rule.regex.ReplaceAllString(p, rule.replacement)
+	}
+
+	if normalizer.fn != nil {
+		p = normalizer.fn(r, p)
+	}
+
+	if p == u.Path {
+		return rawURL, pattern
+	}
+
+	return replacePath(u, p), pattern
+}
+
+// tags returns given tags with the route pattern added if PatternTag is set.
+// The tags are copied, so that the map passed in the PageViewOptions is not modified.
+func (normalizer *URLNormalizer) tags(pattern string, tags map[string]string) map[string]string {
+	if normalizer.patternTag == "" || pattern == "" {
+		return tags
+	}
+
+	withPattern := make(map[string]string, len(tags)+1)
+
+	for k, v := range tags {
+		withPattern[k] = v
+	}
+
+	withPattern[normalizer.patternTag] = pattern
+	return withPattern
+}
+
+// routePattern returns the path of the route pattern matched by the http.ServeMux without the method, host, and {$} suffix.
+func routePattern(r *http.Request) string {
+	pattern := r.Pattern
+
+	// patterns have the form [METHOD ][HOST]/[PATH]
+	if i := strings.Index(pattern, " "); i > -1 {
+		pattern = strings.TrimSpace(pattern[i+1:])
+	}
+
+	if i := strings.Index(pattern, "/"); i > -1 {
+		pattern = pattern[i:]
+	} else {
+		return ""
+	}
+
+	return strings.TrimSuffix(pattern, "{$}")
+}
+
+// replacePath returns given URL with the path replaced.
+// Braces are not escaped, so that route patterns remain readable.
+func replacePath(u *url.URL, p string) string {
+	var sb strings.Builder
+	escaped := (&url.URL{Path: p}).EscapedPath()
+	escaped = strings.NewReplacer("%7B", "{", "%7D", "}").Replace(escaped)
+	u.Path, u.RawPath = "", ""
+	query, fragment := u.RawQuery, u.EscapedFragment()
+	u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+	sb.WriteString(u.String())
+	sb.WriteString(escaped)
+
+	if query != "" {
+		sb.WriteString("?")
+		sb.WriteString(query)
+	}
+
+	if fragment != "" {
+		sb.WriteString("#")
+		sb.WriteString(fragment)
+	}
+
+	return sb.String()
+}
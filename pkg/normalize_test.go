@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestURLNormalizer(t *testing.T) {
+	normalizer, err := NewURLNormalizer(&URLNormalizerConfig{
+		UseRoutePattern: true,
+		Rules: []URLRewriteRule{
+			{Pattern: `/[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`, Replacement: "/{uuid}"},
+		},
+		Func: func(r *http.Request, path string) string {
+			if len(path) > 1 {
+				return strings.TrimSuffix(path, "/")
+			}
+
+			return path
+		},
+		PatternTag: "route",
+	})
+	assert.NoError(t, err)
+	mux := http.NewServeMux()
+	var normalized, pattern string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		normalized, pattern = normalizer.normalize(r, r.URL.String())
+	})
+	mux.Handle("GET /users/{id}/orders/{oid}", handler)
+	mux.Handle("/files/{path...}", handler)
+	mux.Handle("/static/", handler)
+	mux.Handle("/{$}", handler)
+	input := []struct {
+		url        string
+		normalized string
+		pattern    string
+	}{
+		{"https://example.com/users/8123/orders/99?utm_source=newsletter", "https://example.com/users/{id}/orders/{oid}?utm_source=newsletter", "/users/{id}/orders/{oid}"},
+		{"https://example.com/files/a/b.pdf", "https://example.com/files/{path...}", "/files/{path...}"},
+		{"https://example.com/static/a5b3c4d2-1234-5678-9abc-def012345678/", "https://example.com/static/{uuid}", "/static/"},
+		{"https://example.com/", "https://example.com/", "/"},
+	}
+
+	for _, in := range input {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, in.url, nil))
+		assert.Equal(t, in.normalized, normalized)
+		assert.Equal(t, in.pattern, pattern)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/partials/12", nil)
+	req.Pattern = "/partials/{id}"
+	assert.Equal(t, "https://example.com/partials/{id}", normalizer.Normalize(req, req.URL.String()))
+	assert.Equal(t, "https://example.com/page/12", normalizer.Normalize(req, "https://example.com/page/12"))
+	assert.Equal(t, "https://example.com/static/{uuid}", normalizer.Normalize(nil, "https://example.com/static/a5b3c4d2-1234-5678-9abc-def012345678/"))
+	_, err = NewURLNormalizer(&URLNormalizerConfig{Rules: []URLRewriteRule{{Pattern: "("}}})
+	assert.Error(t, err)
+}
+
+func TestClientURLNormalizer(t *testing.T) {
+	normalizer, err := NewURLNormalizer(&URLNormalizerConfig{
+		UseRoutePattern: true,
+		PatternTag:      "route",
+	})
+	assert.NoError(t, err)
+	client := NewClient("", "secret", &ClientConfig{
+		URLNormalizer: normalizer,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/users/8123", nil)
+	req.Pattern = "GET example.com/users/{id}"
+	tags := map[string]string{"author": "john"}
+	hit := client.getPageViewData(req, &PageViewOptions{Tags: tags})
+	assert.Equal(t, "https://example.com/users/{id}", hit.URL)
+	assert.Equal(t, map[string]string{"author": "john", "route": "/users/{id}"}, hit.Tags)
+	assert.Len(t, tags, 1)
+	event := client.getEventData("event", 0, nil, req, new(PageViewOptions))
+	assert.Equal(t, "https://example.com/users/{id}", event.URL)
+	session := client.getSessionData(req, new(PageViewOptions))
+	assert.Equal(t, "https://example.com/users/{id}", session.URL)
+}
+
+func TestClientURLNormalizerExplicitURL(t *testing.T) {
+	normalizer, err := NewURLNormalizer(&URLNormalizerConfig{
+		Rules: []URLRewriteRule{{Pattern: `/[0-9]+`, Replacement: "/{id}"}},
+	})
+	assert.NoError(t, err)
+	var hit PageView
+	client := NewClient("", "secret", &ClientConfig{
+		URLNormalizer: normalizer,
+		HTTPClient: &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&hit))
+				return httptest.NewRecorder().Result(), nil
+			}),
+		},
+	})
+	assert.NoError(t, client.TrackPageView(context.Background(), &PageViewInput{
+		Visitor: VisitorContext{
+			IP:        "198.51.100.1",
+			UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+		},
+		URL: "https://example.com/invoices/8123",
+	}))
+	assert.Equal(t, "https://example.com/invoices/{id}", hit.URL)
+}
@@ -0,0 +1,193 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay  = time.Millisecond * 500
+	defaultRetryMaxDelay   = time.Second * 5
+	defaultRetryMaxElapsed = time.Second * 10
+)
+
+// RetryAction is the action the Client takes after a failed request.
+type RetryAction int
+
+const (
+	// RetryActionFail returns the error to the caller.
+	RetryActionFail RetryAction = iota
+
+	// RetryActionRetry retries the request after the returned delay.
+	RetryActionRetry
+
+	// RetryActionRefreshToken refreshes the access token and retries the request after the returned delay.
+	// The request fails if the access token cannot be refreshed (e.g. when using single access tokens).
+	RetryActionRefreshToken
+)
+
+// RetryPolicy decides whether and when a failed request is retried.
+type RetryPolicy interface {
+	// Next returns the action and delay for a failed request.
+	// The attempt starts at 1 for the first failed request and elapsed is the time passed since the first request has been sent.
+	// The error is an *APIError (possibly wrapped) if the API responded with an unexpected status code,
+	// or a network error, token refresh error, or invalid response otherwise.
+	Next(attempt int, elapsed time.Duration, err error) (RetryAction, time.Duration)
+}
+
+// RetryBudget can be implemented by a RetryPolicy to limit the total duration of a request.
+// The Client cancels the request once the budget is exceeded, including the attempt in flight, and returns ErrRetryBudgetExceeded.
+type RetryBudget interface {
+	// Budget returns the maximum duration of a request including all attempts, token refreshes, and delays.
+	// Zero or less disables the limit.
+	Budget() time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by the Client if none is configured.
+// It refreshes the access token on 401, honors the Retry-After header on 429 and 503,
+// retries network errors, token refresh errors, and 5xx responses using exponential backoff with jitter,
+// and fails fast on all other errors (like invalid responses).
+type DefaultRetryPolicy struct {
+	// MaxRetries is the maximum number of retries. 5 by default.
+	MaxRetries int
+
+	// BaseDelay is the delay before the first retry, which is doubled for every further retry. 500 milliseconds by default.
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay between two requests. 5 seconds by default.
+	MaxDelay time.Duration
+
+	// MaxElapsed is the maximum duration of a request including all retries, measured from the first request.
+	// No retry is attempted if it would exceed this limit and the attempt in flight is canceled once it has been reached.
+	// 10 seconds by default.
+	MaxElapsed time.Duration
+}
+
+// Next implements the RetryPolicy interface.
+func (policy *DefaultRetryPolicy) Next(attempt int, elapsed time.Duration, err error) (RetryAction, time.Duration) {
+	maxRetries := policy.MaxRetries
+
+	if maxRetries <= 0 {
+		maxRetries = defaultRequestRetries
+	}
+
+	if attempt > maxRetries || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return RetryActionFail, 0
+	}
+
+	action := RetryActionRetry
+	delay := policy.backoff(attempt)
+	var apiErr *APIError
+	var refreshErr *tokenRefreshError
+
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized:
+			action, delay = RetryActionRefreshToken, 0
+		case apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode == http.StatusServiceUnavailable:
+			if retryAfter, ok := parseRetryAfter(apiErr.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+		case apiErr.StatusCode < http.StatusInternalServerError:
+			return RetryActionFail, 0
+		}
+	} else if !errors.As(err, &refreshErr) && !isNetworkError(err) {
+		return RetryActionFail, 0
+	}
+
+	if elapsed+delay > policy.Budget() {
+		return RetryActionFail, 0
+	}
+
+	return action, delay
+}
+
+// Budget implements the RetryBudget interface.
+func (policy *DefaultRetryPolicy) Budget() time.Duration {
+	if policy.MaxElapsed <= 0 {
+		return defaultRetryMaxElapsed
+	}
+
+	return policy.MaxElapsed
+}
+
+func (policy *DefaultRetryPolicy) backoff(attempt int) time.Duration {
+	base := policy.BaseDelay
+
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+
+	maxDelay := policy.MaxDelay
+
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+
+	delay := maxDelay
+
+	// shift the maximum delay instead of the base delay, so that large delays cannot overflow
+	if maxDelay>>(attempt-1) > base {
+		delay = base << (attempt - 1)
+	}
+
+	// use jitter in the range [delay/2, delay] to spread out retries of concurrent requests
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Second * time.Duration(seconds), true
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		return max(time.Until(t), 0), true
+	}
+
+	return 0, false
+}
+
+// tokenRefreshError is returned for an attempt if the access token could not be refreshed.
+type tokenRefreshError struct {
+	attempt int
+	err     error
+}
+
+// Error implements the error interface.
+func (err *tokenRefreshError) Error() string {
+	return fmt.Sprintf("error refreshing token (attempt %d): %s", err.attempt, err.err)
+}
+
+// Unwrap returns the token source error.
+func (err *tokenRefreshError) Unwrap() error {
+	return err.err
+}
+
+// isNetworkError returns whether the error was caused by the connection to the API (like a timeout or connection reset),
+// rather than by the request or response itself.
+func isNetworkError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var urlErr *url.Error
+
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
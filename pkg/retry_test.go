@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	policy := &DefaultRetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  time.Second,
+		MaxDelay:   time.Second * 3,
+		MaxElapsed: time.Second * 10,
+	}
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+	networkErr := &url.Error{Op: "Post", URL: "https://api.pirsch.io", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	input := []struct {
+		attempt int
+		elapsed time.Duration
+		err     error
+		action  RetryAction
+		min     time.Duration
+		max     time.Duration
+	}{
+		{1, 0, networkErr, RetryActionRetry, time.Millisecond * 500, time.Second},
+		{2, 0, networkErr, RetryActionRetry, time.Second, time.Second * 2},
+		{3, 0, networkErr, RetryActionRetry, time.Millisecond * 1500, time.Second * 3},
+		{4, 0, networkErr, RetryActionFail, 0, 0},
+		{1, time.Second * 10, networkErr, RetryActionFail, 0, 0},
+		{1, 0, io.ErrUnexpectedEOF, RetryActionRetry, time.Millisecond * 500, time.Second},
+		{1, 0, &tokenRefreshError{1, errors.New("error")}, RetryActionRetry, time.Millisecond * 500, time.Second},
+		{1, 0, &json.SyntaxError{}, RetryActionFail, 0, 0},
+		{1, 0, &url.Error{Op: "Get", URL: "ftp://api.pirsch.io", Err: errors.New("unsupported protocol scheme")}, RetryActionFail, 0, 0},
+		{1, 0, &APIError{StatusCode: http.StatusUnauthorized}, RetryActionRefreshToken, 0, 0},
+		{1, 0, &APIError{StatusCode: http.StatusBadRequest}, RetryActionFail, 0, 0},
+		{1, 0, &APIError{StatusCode: http.StatusNotFound}, RetryActionFail, 0, 0},
+		{1, 0, &APIError{StatusCode: http.StatusInternalServerError}, RetryActionRetry, time.Millisecond * 500, time.Second},
+		{1, 0, &APIError{StatusCode: http.StatusTooManyRequests, Header: header}, RetryActionRetry, time.Second * 7, time.Second * 7},
+		{1, time.Second * 5, &APIError{StatusCode: http.StatusServiceUnavailable, Header: header}, RetryActionFail, 0, 0},
+	}
+
+	for _, in := range input {
+		action, delay := policy.Next(in.attempt, in.elapsed, in.err)
+		assert.Equal(t, in.action, action)
+		assert.GreaterOrEqual(t, delay, in.min)
+		assert.LessOrEqual(t, delay, in.max)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var tokenRequests, hitRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case authenticationEndpoint:
+			tokenRequests++
+			_, _ = fmt.Fprintf(w, `{"access_token": "token%d", "expires_at": "2100-01-01T00:00:00Z"}`, tokenRequests)
+		case hitEndpoint:
+			hitRequests++
+
+			if hitRequests == 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+			} else if hitRequests == 2 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		case eventEndpoint:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	client := NewClient("id", "secret", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{BaseDelay: time.Millisecond},
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.NoError(t, client.PageView(req, nil))
+	assert.Equal(t, 2, tokenRequests)
+	assert.Equal(t, 3, hitRequests)
+	err := client.Event("event", 0, nil, req, nil)
+	assert.Error(t, err)
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, 2, tokenRequests)
+}
+
+func TestClientRetryBudget(t *testing.T) {
+	var statsRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case authenticationEndpoint:
+			_, _ = w.Write([]byte(`{"access_token": "token", "expires_at": "2100-01-01T00:00:00Z"}`))
+		case hitEndpoint:
+			_, _ = io.Copy(io.Discard, r.Body)
+
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second * 5):
+			}
+		case visitorsEndpoint:
+			statsRequests++
+			_, _ = w.Write([]byte(`{"visitors": invalid}`))
+		}
+	}))
+	defer server.Close()
+	client := NewClient("id", "secret", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{BaseDelay: time.Millisecond, MaxElapsed: time.Millisecond * 100},
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	start := time.Now()
+	err := client.PageView(req, nil)
+	assert.ErrorIs(t, err, ErrRetryBudgetExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	_, err = client.Visitors(&Filter{DomainID: "domain", From: time.Now(), To: time.Now()})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRetryBudgetExceeded)
+	assert.Equal(t, 1, statsRequests)
+}
+
+func TestDefaultRetryPolicyBackoffOverflow(t *testing.T) {
+	policy := &DefaultRetryPolicy{
+		MaxRetries: 100,
+		BaseDelay:  time.Second * 10,
+		MaxDelay:   time.Hour * 1000,
+	}
+
+	for attempt := 1; attempt <= 100; attempt++ {
+		delay := policy.backoff(attempt)
+		assert.Greater(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, policy.MaxDelay)
+	}
+}
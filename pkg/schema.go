@@ -0,0 +1,308 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const eventSchemaTag = "pirsch"
+
+var (
+	eventSchemas sync.Map // reflect.Type -> *eventSchema
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// EventSchema is implemented by structs defining a typed event.
+// The exported fields are sent as event metadata, using the key set in the pirsch struct tag or the field name if not set.
+// Supported field types are strings, bools, integers, floats, time.Time, time.Duration, and pointers to them.
+// Tag options:
+//
+//	`pirsch:"key"`            sends the field as metadata using the key
+//	`pirsch:"key,omitempty"`  skips the field if it has the zero value (or is a nil pointer)
+//	`pirsch:",duration"`      sends the field as the event duration (integer in seconds or time.Duration)
+//	`pirsch:"-"`              skips the field
+//
+// Example:
+//
+//	type Checkout struct {
+//		Plan  string `pirsch:"plan"`
+//		Seats int    `pirsch:"seats"`
+//	}
+//
+//	func (Checkout) EventName() string {
+//		return "Checkout"
+//	}
+type EventSchema interface {
+	// EventName returns the event name.
+	EventName() string
+}
+
+// eventSchema is the validated definition of an EventSchema type.
+type eventSchema struct {
+	fields   []eventSchemaField
+	duration []int
+}
+
+type eventSchemaField struct {
+	key       string
+	index     []int
+	omitEmpty bool
+}
+
+// RegisterEvent validates the EventSchema type of given event, so that invalid definitions are detected early (e.g. on startup).
+// Events are registered automatically when they are tracked for the first time.
+func RegisterEvent(event EventSchema) error {
+	_, err := getEventSchema(event)
+	return err
+}
+
+// MustRegisterEvent is the same as RegisterEvent, but panics if the EventSchema is invalid.
+func MustRegisterEvent(event EventSchema) {
+	if err := RegisterEvent(event); err != nil {
+		panic(err)
+	}
+}
+
+// NewEventInput returns the EventInput for given visitor and event to be sent using Client.TrackEvent.
+func NewEventInput(visitor VisitorContext, event EventSchema) (*EventInput, error) {
+	name, durationSeconds, meta, err := eventData(event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventInput{
+		Visitor:         visitor,
+		Name:            name,
+		DurationSeconds: durationSeconds,
+		Meta:            meta,
+	}, nil
+}
+
+// Track sends a typed event to Pirsch for given http.Request.
+func (client *Client) Track(ctx context.Context, r *http.Request, event EventSchema) error {
+	name, durationSeconds, meta, err := eventData(event)
+
+	if err != nil {
+		return err
+	}
+
+	return client.EventContext(ctx, name, durationSeconds, meta, r, nil)
+}
+
+// Track queues a typed event for given http.Request.
+func (tracker *AsyncTracker) Track(r *http.Request, event EventSchema) error {
+	name, durationSeconds, meta, err := eventData(event)
+
+	if err != nil {
+		return err
+	}
+
+	return tracker.Event(name, durationSeconds, meta, r, nil)
+}
+
+// eventData returns the event name, duration, and metadata for given event.
+func eventData(event EventSchema) (string, int, map[string]string, error) {
+	schema, err := getEventSchema(event)
+
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(event))
+	meta := make(map[string]string, len(schema.fields))
+
+	for _, field := range schema.fields {
+		// fields of embedded nil pointers are skipped
+		f, err := v.FieldByIndexErr(field.index)
+
+		if err != nil || (field.omitEmpty && f.IsZero()) {
+			continue
+		}
+
+		if value, ok := formatEventValue(f); ok {
+			meta[field.key] = value
+		}
+	}
+
+	durationSeconds := 0
+
+	if schema.duration != nil {
+		f, err := v.FieldByIndexErr(schema.duration)
+		f = reflect.Indirect(f)
+
+		if err == nil && f.IsValid() {
+			if f.Type() == durationType {
+				durationSeconds = int(time.Duration(f.Int()).Seconds())
+			} else if f.CanInt() {
+				durationSeconds = int(f.Int())
+			} else {
+				durationSeconds = int(f.Uint())
+			}
+		}
+	}
+
+	return event.EventName(), durationSeconds, meta, nil
+}
+
+func getEventSchema(event EventSchema) (*eventSchema, error) {
+	if event == nil {
+		return nil, errors.New("event required")
+	}
+
+	t := reflect.TypeOf(event)
+
+	if t.Kind() == reflect.Pointer && reflect.ValueOf(event).IsNil() {
+		return nil, fmt.Errorf("event %s: nil pointer", t)
+	}
+
+	if schema, ok := eventSchemas.Load(t); ok {
+		return schema.(*eventSchema), nil
+	}
+
+	schema, err := parseEventSchema(t, event.EventName())
+
+	if err != nil {
+		return nil, err
+	}
+
+	eventSchemas.Store(t, schema)
+	return schema, nil
+}
+
+func parseEventSchema(t reflect.Type, name string) (*eventSchema, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("event %s: must be a struct", t)
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("event %s: name required", t)
+	}
+
+	schema := new(eventSchema)
+	keys := make(map[string]struct{})
+
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get(eventSchemaTag)
+
+		if tag == "-" {
+			continue
+		}
+
+		key, options, _ := strings.Cut(tag, ",")
+		ft := f.Type
+
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if options == "duration" {
+			if schema.duration != nil {
+				return nil, fmt.Errorf("event %s: duplicate duration field %s", t, f.Name)
+			}
+
+			if ft != durationType && !isEventIntType(ft.Kind()) {
+				return nil, fmt.Errorf("event %s: duration field %s must be an integer or time.Duration", t, f.Name)
+			}
+
+			schema.duration = f.Index
+			continue
+		} else if options != "" && options != "omitempty" {
+			return nil, fmt.Errorf("event %s: unknown tag option %q on field %s", t, options, f.Name)
+		}
+
+		if !isEventValueType(ft) {
+			return nil, fmt.Errorf("event %s: unsupported type %s of field %s", t, f.Type, f.Name)
+		}
+
+		if key == "" {
+			key = f.Name
+		}
+
+		if _, ok := keys[key]; ok {
+			return nil, fmt.Errorf("event %s: duplicate key %q", t, key)
+		}
+
+		keys[key] = struct{}{}
+		schema.fields = append(schema.fields, eventSchemaField{
+			key:       key,
+			index:     f.Index,
+			omitEmpty: options == "omitempty",
+		})
+	}
+
+	return schema, nil
+}
+
+func isEventValueType(t reflect.Type) bool {
+	if t == timeType || t == durationType {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return isEventIntType(t.Kind())
+	}
+}
+
+func isEventIntType(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatEventValue returns the metadata value for given field. False is returned for nil pointers.
+func formatEventValue(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", false
+		}
+
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339), true
+	}
+
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String(), true
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), true
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	default:
+		return strconv.FormatUint(v.Uint(), 10), true
+	}
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testCheckout struct {
+	Plan       string        `pirsch:"plan"`
+	Seats      int           `pirsch:"seats"`
+	Price      float64       `pirsch:"price"`
+	Trial      bool          `pirsch:"trial"`
+	Coupon     *string       `pirsch:"coupon"`
+	Note       string        `pirsch:"note,omitempty"`
+	StartsAt   time.Time     `pirsch:"starts_at"`
+	Period     time.Duration `pirsch:"period"`
+	Duration   int           `pirsch:",duration"`
+	Internal   string        `pirsch:"-"`
+	Region     string
+	unexported string
+}
+
+func (testCheckout) EventName() string {
+	return "Checkout"
+}
+
+type testInvalidEvent struct {
+	Items []string `pirsch:"items"`
+}
+
+func (testInvalidEvent) EventName() string {
+	return "Invalid"
+}
+
+type testDuplicateEvent struct {
+	A string `pirsch:"key"`
+	B string `pirsch:"key"`
+}
+
+func (testDuplicateEvent) EventName() string {
+	return "Duplicate"
+}
+
+type testUnnamedEvent struct{}
+
+func (testUnnamedEvent) EventName() string {
+	return ""
+}
+
+type testStringEvent string
+
+func (testStringEvent) EventName() string {
+	return "String"
+}
+
+func TestEventSchema(t *testing.T) {
+	coupon := "SAVE10"
+	name, duration, meta, err := eventData(testCheckout{
+		Plan:       "pro",
+		Seats:      5,
+		Price:      9.99,
+		Trial:      true,
+		Coupon:     &coupon,
+		StartsAt:   time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Period:     time.Hour * 24,
+		Duration:   42,
+		Internal:   "secret",
+		Region:     "eu",
+		unexported: "unexported",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Checkout", name)
+	assert.Equal(t, 42, duration)
+	assert.Equal(t, map[string]string{
+		"plan":      "pro",
+		"seats":     "5",
+		"price":     "9.99",
+		"trial":     "true",
+		"coupon":    "SAVE10",
+		"starts_at": "2024-05-01T10:00:00Z",
+		"period":    "24h0m0s",
+		"Region":    "eu",
+	}, meta)
+	_, _, meta, err = eventData(&testCheckout{})
+	assert.NoError(t, err)
+	assert.NotContains(t, meta, "coupon")
+	assert.NotContains(t, meta, "note")
+	assert.Equal(t, "0", meta["seats"])
+	assert.NoError(t, RegisterEvent(testCheckout{}))
+	assert.Error(t, RegisterEvent(testInvalidEvent{}))
+	assert.Error(t, RegisterEvent(testDuplicateEvent{}))
+	assert.Error(t, RegisterEvent(testUnnamedEvent{}))
+	assert.Error(t, RegisterEvent(testStringEvent("")))
+	assert.Error(t, RegisterEvent((*testCheckout)(nil)))
+	assert.Error(t, RegisterEvent(nil))
+	assert.Panics(t, func() {
+		MustRegisterEvent(testInvalidEvent{})
+	})
+	input, err := NewEventInput(VisitorContext{IP: "198.51.100.1"}, testCheckout{Plan: "pro"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Checkout", input.Name)
+	assert.Equal(t, "pro", input.Meta["plan"])
+	assert.Equal(t, "198.51.100.1", input.Visitor.IP)
+}
+
+func TestClientTrack(t *testing.T) {
+	events := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/checkout", nil)
+	assert.NoError(t, client.Track(context.Background(), req, testCheckout{Plan: "pro", Seats: 3}))
+	event := <-events
+	assert.Equal(t, "Checkout", event.Name)
+	assert.Equal(t, "pro", event.Metadata["plan"])
+	assert.Equal(t, "3", event.Metadata["seats"])
+	assert.Equal(t, "https://example.com/checkout", event.URL)
+	assert.Error(t, client.Track(context.Background(), req, testInvalidEvent{}))
+	assert.Empty(t, events)
+}
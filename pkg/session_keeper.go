@@ -0,0 +1,205 @@
+package pkg
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionKeeperInterval  = time.Minute
+	defaultSessionKeeperJitter    = 0.1
+	defaultSessionKeeperBatchSize = 100
+	minSessionKeeperTick          = time.Millisecond * 10
+)
+
+// SessionKeeperConfig is used to configure the SessionKeeper.
+type SessionKeeperConfig struct {
+	// Interval is the interval in which sessions are kept alive. One minute by default.
+	Interval time.Duration
+
+	// Jitter is the fraction of the Interval by which each keep-alive is randomly moved, so that connections opened at the same time
+	// don't all fire together. 0.1 (10%) by default. Set to a negative value to disable it.
+	Jitter float64
+
+	// BatchSize is the maximum number of sessions sent in a single request. 100 by default.
+	BatchSize int
+
+	// OnError is called with the error and affected sessions if a batch could not be sent.
+	// Errors are logged using the client logger if not set.
+	OnError func(err error, sessions []BatchPageView)
+}
+
+// SessionKeeper keeps sessions alive for long-lived connections like WebSockets or server-sent events,
+// so that visitors staying on a page without further page views are not counted as bounces.
+// Keep-alives for all registered connections are collected and sent in batches.
+type SessionKeeper struct {
+	client    *Client
+	interval  time.Duration
+	jitter    float64
+	batchSize int
+	onError   func(error, []BatchPageView)
+	sessions  map[*keptSession]struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	m         sync.Mutex
+}
+
+// keptSession is a connection registered with the SessionKeeper.
+type keptSession struct {
+	session PageView
+	due     time.Time
+}
+
+// NewSessionKeeper creates a new SessionKeeper for given Client and optional configuration and starts it.
+// Make sure to call Close once it's no longer needed.
+func NewSessionKeeper(client *Client, config *SessionKeeperConfig) *SessionKeeper {
+	if config == nil {
+		config = new(SessionKeeperConfig)
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = defaultSessionKeeperInterval
+	}
+
+	if config.Jitter == 0 {
+		config.Jitter = defaultSessionKeeperJitter
+	} else if config.Jitter < 0 {
+		config.Jitter = 0
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultSessionKeeperBatchSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	keeper := &SessionKeeper{
+		client:    client,
+		interval:  config.Interval,
+		jitter:    min(config.Jitter, 1),
+		batchSize: config.BatchSize,
+		onError:   config.OnError,
+		sessions:  make(map[*keptSession]struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	keeper.wg.Add(1)
+	go keeper.run()
+	return keeper
+}
+
+// Keep registers a connection for given http.Request and options and keeps its session alive until the context is canceled.
+// Pass the context of the connection, like http.Request.Context for WebSocket and server-sent event handlers.
+// The session data is read from the request immediately, so the request can be reused once this function returns.
+// ErrFilteredBot is returned if the request has been sent by a bot and ErrClosed if the SessionKeeper has been closed.
+func (keeper *SessionKeeper) Keep(ctx context.Context, r *http.Request, options *PageViewOptions) error {
+	if options == nil {
+		options = new(PageViewOptions)
+	}
+
+	session := keeper.client.getSessionData(r, options)
+
+	if err := keeper.client.filterBot(&session); err != nil {
+		return err
+	}
+
+	kept := &keptSession{
+		session: session,
+		due:     keeper.next(time.Now()),
+	}
+	keeper.m.Lock()
+
+	if keeper.ctx.Err() != nil {
+		keeper.m.Unlock()
+		return ErrClosed
+	}
+
+	keeper.sessions[kept] = struct{}{}
+	keeper.m.Unlock()
+	context.AfterFunc(ctx, func() {
+		keeper.m.Lock()
+		defer keeper.m.Unlock()
+		delete(keeper.sessions, kept)
+	})
+	return nil
+}
+
+// Len returns the number of registered connections.
+func (keeper *SessionKeeper) Len() int {
+	keeper.m.Lock()
+	defer keeper.m.Unlock()
+	return len(keeper.sessions)
+}
+
+// Close stops sending keep-alives and removes all registered connections.
+func (keeper *SessionKeeper) Close() {
+	keeper.m.Lock()
+	keeper.cancel()
+	clear(keeper.sessions)
+	keeper.m.Unlock()
+	keeper.wg.Wait()
+}
+
+func (keeper *SessionKeeper) run() {
+	defer keeper.wg.Done()
+	ticker := time.NewTicker(max(keeper.interval/10, minSessionKeeperTick))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-keeper.ctx.Done():
+			return
+		case now := <-ticker.C:
+			keeper.send(keeper.due(now))
+		}
+	}
+}
+
+// due returns the sessions due at given time and schedules their next keep-alive.
+func (keeper *SessionKeeper) due(now time.Time) []BatchPageView {
+	keeper.m.Lock()
+	defer keeper.m.Unlock()
+	sessions := make([]BatchPageView, 0)
+
+	for kept := range keeper.sessions {
+		if !kept.due.After(now) {
+			sessions = append(sessions, BatchPageView{
+				PageView: kept.session,
+				Time:     now.UTC(),
+			})
+			kept.due = keeper.next(now)
+		}
+	}
+
+	return sessions
+}
+
+func (keeper *SessionKeeper) send(sessions []BatchPageView) {
+	for len(sessions) > 0 {
+		n := min(len(sessions), keeper.batchSize)
+
+		if err := keeper.client.SessionBatchContext(keeper.ctx, sessions[:n]); err != nil && keeper.ctx.Err() == nil {
+			if keeper.onError != nil {
+				keeper.onError(err, sessions[:n])
+			} else if keeper.client.logger != nil {
+				keeper.client.logger.Error("error sending session keep-alives", "err", err, "sessions", n)
+			}
+		}
+
+		sessions = sessions[n:]
+	}
+}
+
+// next returns the time of the next keep-alive, moved randomly by up to the jitter in both directions.
+func (keeper *SessionKeeper) next(now time.Time) time.Time {
+	d := keeper.interval
+
+	if keeper.jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * keeper.jitter * float64(keeper.interval))
+	}
+
+	return now.Add(d)
+}
@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionKeeper(t *testing.T) {
+	var m sync.Mutex
+	var batches [][]BatchPageView
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, sessionBatchEndpoint, r.URL.Path)
+		var sessions []BatchPageView
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&sessions))
+		m.Lock()
+		batches = append(batches, sessions)
+		m.Unlock()
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	keeper := NewSessionKeeper(client, &SessionKeeperConfig{
+		Interval:  time.Millisecond * 100,
+		BatchSize: 3,
+	})
+	defer keeper.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/live", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0")
+		assert.NoError(t, keeper.Keep(ctx, req, nil))
+	}
+
+	assert.Equal(t, 5, keeper.Len())
+	time.Sleep(time.Millisecond * 250)
+	cancel()
+	assert.Eventually(t, func() bool {
+		return keeper.Len() == 0
+	}, time.Second, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 150)
+	m.Lock()
+	sent := 0
+
+	for _, batch := range batches {
+		assert.LessOrEqual(t, len(batch), 3)
+		sent += len(batch)
+
+		for _, session := range batch {
+			assert.Equal(t, "https://example.com/live", session.URL)
+			assert.False(t, session.Time.IsZero())
+		}
+	}
+
+	assert.GreaterOrEqual(t, sent, 5)
+	assert.LessOrEqual(t, sent, 15)
+	m.Unlock()
+	keeper.Close()
+	assert.ErrorIs(t, keeper.Keep(context.Background(), httptest.NewRequest(http.MethodGet, "/", nil), nil), ErrClosed)
+}
+
+func TestSessionKeeperNext(t *testing.T) {
+	keeper := &SessionKeeper{interval: time.Minute, jitter: 0.1}
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		next := keeper.next(now).Sub(now)
+		assert.GreaterOrEqual(t, next, time.Second*54)
+		assert.LessOrEqual(t, next, time.Second*66)
+	}
+
+	keeper.jitter = 0
+	assert.Equal(t, time.Minute, keeper.next(now).Sub(now))
+}
@@ -0,0 +1,417 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSpoolSegmentSize    = 4 << 20  // 4 MiB
+	defaultSpoolMaxSize        = 64 << 20 // 64 MiB
+	defaultSpoolReplayInterval = time.Second * 30
+	spoolSegmentExt            = ".spool"
+	spoolRecordHeaderSize      = 8
+)
+
+// ErrSpoolFull is returned if data cannot be written to the Spool because it reached its maximum size.
+var ErrSpoolFull = errors.New("spool full")
+
+// SpoolConfig is used to configure the Spool.
+type SpoolConfig struct {
+	// Dir is the directory the segment files are stored in. It is created if it doesn't exist.
+	Dir string
+
+	// SegmentSize is the size in bytes after which a new segment file is started. 4 MiB by default.
+	SegmentSize int64
+
+	// MaxSize is the maximum size in bytes of all segment files. New data is rejected once the limit is reached. 64 MiB by default.
+	MaxSize int64
+
+	// ReplayInterval is the interval in which the Client tries to send spooled data. 30 seconds by default.
+	ReplayInterval time.Duration
+
+	// Logger is used to report discarded data. Logs to stderr by default.
+	Logger slog.Handler
+}
+
+// Spool is a durable on-disk queue for tracking data that could not be sent to Pirsch.
+// Data is appended to segment files as checksummed records and replayed in order once the API is reachable again.
+// Delivery is at-least-once: data is removed after it has been sent successfully,
+// so a crash during replay can cause records to be sent twice.
+// A torn or corrupted record cannot be recovered, because the records following it cannot be located reliably.
+// It is discarded together with the rest of its segment, which is logged and counted by Discarded.
+type Spool struct {
+	dir            string
+	segmentSize    int64
+	maxSize        int64
+	replayInterval time.Duration
+	active         *os.File
+	activeID       uint64
+	activeSize     int64
+	size           int64
+	discarded      atomic.Int64
+	logger         *slog.Logger
+	replayed       map[uint64]int64
+	closed         chan struct{}
+	m              sync.Mutex
+	replayM        sync.Mutex
+}
+
+// spoolRecord is the JSON payload of a single record in a segment file.
+type spoolRecord struct {
+	PageViews []BatchPageView `json:"page_views,omitempty"`
+	Events    []BatchEvent    `json:"events,omitempty"`
+	Sessions  []BatchPageView `json:"sessions,omitempty"`
+}
+
+// OpenSpool opens or creates a Spool for given configuration.
+// Existing segments are kept for replay, new data is written to a new segment.
+func OpenSpool(config SpoolConfig) (*Spool, error) {
+	if config.Dir == "" {
+		return nil, errors.New("spool directory required")
+	}
+
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = defaultSpoolSegmentSize
+	}
+
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultSpoolMaxSize
+	}
+
+	if config.ReplayInterval <= 0 {
+		config.ReplayInterval = defaultSpoolReplayInterval
+	}
+
+	if config.Logger == nil {
+		config.Logger = slog.NewTextHandler(os.Stderr, nil)
+	}
+
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	spool := &Spool{
+		dir:            config.Dir,
+		segmentSize:    config.SegmentSize,
+		maxSize:        config.MaxSize,
+		replayInterval: config.ReplayInterval,
+		logger:         slog.New(config.Logger),
+		replayed:       make(map[uint64]int64),
+		closed:         make(chan struct{}),
+	}
+	segments, err := spool.segments()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range segments {
+		info, err := os.Stat(spool.segmentPath(id))
+
+		if err != nil {
+			return nil, err
+		}
+
+		spool.size += info.Size()
+		spool.activeID = id
+	}
+
+	// never append to existing segments, as they might end with a torn record after a crash
+	if err := spool.rotate(); err != nil {
+		return nil, err
+	}
+
+	return spool, nil
+}
+
+// Append writes the batch to the Spool.
+func (spool *Spool) Append(batch *Batch) error {
+	payload, err := json.Marshal(&spoolRecord{
+		PageViews: batch.PageViews,
+		Events:    batch.Events,
+		Sessions:  batch.Sessions,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, spoolRecordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[spoolRecordHeaderSize:], payload)
+	spool.m.Lock()
+	defer spool.m.Unlock()
+
+	if spool.active == nil {
+		return ErrClosed
+	}
+
+	if spool.size+int64(len(record)) > spool.maxSize {
+		return ErrSpoolFull
+	}
+
+	if spool.activeSize > 0 && spool.activeSize+int64(len(record)) > spool.segmentSize {
+		if err := spool.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := spool.active.Write(record); err != nil {
+		return err
+	}
+
+	if err := spool.active.Sync(); err != nil {
+		return err
+	}
+
+	spool.activeSize += int64(len(record))
+	spool.size += int64(len(record))
+	return nil
+}
+
+// Replay calls send for all records in the Spool in the order they have been written.
+// Segments are removed once all of their records have been sent. Replay stops at the first error returned by send.
+func (spool *Spool) Replay(ctx context.Context, send func(context.Context, *Batch) error) error {
+	spool.replayM.Lock()
+	defer spool.replayM.Unlock()
+	spool.m.Lock()
+
+	if spool.active == nil {
+		spool.m.Unlock()
+		return ErrClosed
+	}
+
+	// seal the active segment, so that all data written until now is replayed
+	if spool.activeSize > 0 {
+		if err := spool.rotate(); err != nil {
+			spool.m.Unlock()
+			return err
+		}
+	}
+
+	activeID := spool.activeID
+	spool.m.Unlock()
+	segments, err := spool.segments()
+
+	if err != nil {
+		return err
+	}
+
+	for _, id := range segments {
+		if id >= activeID {
+			break
+		}
+
+		if err := spool.replaySegment(ctx, id, send); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Size returns the total size of all segment files in bytes.
+func (spool *Spool) Size() int64 {
+	spool.m.Lock()
+	defer spool.m.Unlock()
+	return spool.size
+}
+
+// Discarded returns the number of bytes that have been discarded during replay because of torn or corrupted records.
+func (spool *Spool) Discarded() int64 {
+	return spool.discarded.Load()
+}
+
+// Close closes the active segment file. Spooled data is kept on disk and replayed after the Spool has been opened again.
+func (spool *Spool) Close() error {
+	spool.m.Lock()
+	defer spool.m.Unlock()
+
+	if spool.active == nil {
+		return nil
+	}
+
+	close(spool.closed)
+	err := spool.active.Close()
+	spool.active = nil
+	return err
+}
+
+func (spool *Spool) replaySegment(ctx context.Context, id uint64, send func(context.Context, *Batch) error) error {
+	path := spool.segmentPath(id)
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = f.Close() }()
+	offset := spool.replayed[id]
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+
+	for {
+		batch, n, err := spool.readRecord(reader)
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			spool.discard(path, offset, err)
+			break
+		}
+
+		if err := send(ctx, batch); err != nil {
+			return err
+		}
+
+		offset += n
+		spool.replayed[id] = offset
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	delete(spool.replayed, id)
+	spool.m.Lock()
+	spool.size -= info.Size()
+	spool.m.Unlock()
+	return nil
+}
+
+func (spool *Spool) discard(path string, offset int64, err error) {
+	info, statErr := os.Stat(path)
+
+	if statErr != nil {
+		spool.logger.Error("error discarding spooled data", "segment", path, "offset", offset, "err", statErr)
+		return
+	}
+
+	discarded := info.Size() - offset
+	spool.discarded.Add(discarded)
+	spool.logger.Error("discarding rest of spool segment after torn or corrupted record", "segment", path, "offset", offset, "bytes", discarded, "err", err)
+}
+
+func (spool *Spool) readRecord(reader io.Reader) (*Batch, int64, error) {
+	header := make([]byte, spoolRecordHeaderSize)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, errors.New("torn record header")
+		}
+
+		return nil, 0, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+
+	if int64(size) > spool.segmentSize+spool.maxSize {
+		return nil, 0, errors.New("invalid record size")
+	}
+
+	payload := make([]byte, size)
+
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, errors.New("torn record")
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+
+	record := new(spoolRecord)
+
+	if err := json.Unmarshal(payload, record); err != nil {
+		return nil, 0, err
+	}
+
+	return &Batch{
+		PageViews: record.PageViews,
+		Events:    record.Events,
+		Sessions:  record.Sessions,
+	}, int64(spoolRecordHeaderSize + size), nil
+}
+
+func (spool *Spool) rotate() error {
+	if spool.active != nil {
+		if err := spool.active.Close(); err != nil {
+			return err
+		}
+	}
+
+	spool.activeID++
+	f, err := os.OpenFile(spool.segmentPath(spool.activeID), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+
+	if err != nil {
+		spool.active = nil
+		return err
+	}
+
+	spool.active = f
+	spool.activeSize = 0
+	return nil
+}
+
+func (spool *Spool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(spool.dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]uint64, 0, len(entries))
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, id)
+	}
+
+	slices.Sort(segments)
+	return segments, nil
+}
+
+func (spool *Spool) segmentPath(id uint64) string {
+	return filepath.Join(spool.dir, fmt.Sprintf("%020d%s", id, spoolSegmentExt))
+}
@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpoolCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(SpoolConfig{Dir: dir, SegmentSize: 200})
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, spool.Append(&Batch{
+			Events: []BatchEvent{{Event: Event{Name: string(rune('a' + i))}}},
+		}))
+	}
+
+	// simulate a crash while writing the last record
+	segments, err := spool.segments()
+	assert.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+	f, err := os.OpenFile(spool.segmentPath(segments[len(segments)-1]), os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 42, 42})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.NoError(t, spool.Close())
+
+	spool, err = OpenSpool(SpoolConfig{Dir: dir, SegmentSize: 200})
+	assert.NoError(t, err)
+	assert.NoError(t, spool.Append(&Batch{
+		Events: []BatchEvent{{Event: Event{Name: "f"}}},
+	}))
+	var names []string
+	assert.NoError(t, spool.Replay(context.Background(), func(_ context.Context, batch *Batch) error {
+		names = append(names, batch.Events[0].Name)
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, names)
+	assert.Equal(t, int64(6), spool.Discarded())
+	assert.Equal(t, int64(0), spool.Size())
+	assert.NoError(t, spool.Close())
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, ErrClosed, spool.Append(&Batch{}))
+}
+
+func TestSpoolCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	var logs strings.Builder
+	spool, err := OpenSpool(SpoolConfig{Dir: dir, Logger: slog.NewTextHandler(&logs, nil)})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, spool.Append(&Batch{
+			Events: []BatchEvent{{Event: Event{Name: string(rune('a' + i))}}},
+		}))
+	}
+
+	// corrupt the payload of the record in the middle of the segment
+	segments, err := spool.segments()
+	assert.NoError(t, err)
+	assert.Len(t, segments, 1)
+	path := spool.segmentPath(segments[0])
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	recordSize := int64(len(data) / 3)
+	data[recordSize+spoolRecordHeaderSize+1] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	var names []string
+	assert.NoError(t, spool.Replay(context.Background(), func(_ context.Context, batch *Batch) error {
+		names = append(names, batch.Events[0].Name)
+		return nil
+	}))
+	assert.Equal(t, []string{"a"}, names)
+	assert.Equal(t, recordSize*2, spool.Discarded())
+	assert.Contains(t, logs.String(), "record checksum mismatch")
+	assert.Equal(t, int64(0), spool.Size())
+	assert.NoError(t, spool.Close())
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), MaxSize: 500})
+	assert.NoError(t, err)
+	defer func() { _ = spool.Close() }()
+	batch := &Batch{Events: []BatchEvent{{Event: Event{Name: "event"}}}}
+	assert.NoError(t, spool.Append(batch))
+	assert.ErrorIs(t, spool.Append(batch), ErrSpoolFull)
+}
+
+func TestClientSpool(t *testing.T) {
+	var available atomic.Bool
+	var m sync.Mutex
+	var events []BatchEvent
+	var views []BatchPageView
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+
+		switch r.URL.Path {
+		case eventBatchEndpoint:
+			var batch []BatchEvent
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			events = append(events, batch...)
+
+			// fail after the first replayed record has been received to test at-least-once delivery
+			if len(events) <= 2 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		case hitBatchEndpoint:
+			var batch []BatchPageView
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			views = append(views, batch...)
+		default:
+			t.Fatalf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	spool, err := OpenSpool(SpoolConfig{Dir: dir, ReplayInterval: time.Hour})
+	assert.NoError(t, err)
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+		Spool:       spool,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	start := time.Now().UTC()
+	assert.NoError(t, client.Event("first", 0, nil, req, nil))
+	assert.NoError(t, client.Event("second", 0, nil, req, nil))
+	assert.NoError(t, client.PageView(req, nil))
+	assert.Greater(t, spool.Size(), int64(0))
+
+	// the API is still unavailable, so the data is kept
+	assert.Error(t, client.ReplaySpool(context.Background()))
+	available.Store(true)
+	time.Sleep(time.Millisecond * 10)
+	var apiErr *APIError
+	assert.True(t, errors.As(client.ReplaySpool(context.Background()), &apiErr))
+	assert.NoError(t, client.ReplaySpool(context.Background()))
+	assert.Equal(t, int64(0), spool.Size())
+	m.Lock()
+	assert.Len(t, events, 4)
+	assert.Equal(t, "first", events[0].Name)
+	assert.Equal(t, "first", events[1].Name)
+	assert.Equal(t, "first", events[2].Name)
+	assert.Equal(t, "second", events[3].Name)
+	assert.Len(t, views, 1)
+
+	// the original time is kept
+	assert.False(t, events[3].Time.Before(start))
+	assert.True(t, events[3].Time.Before(time.Now().Add(-time.Millisecond*10)))
+	m.Unlock()
+	assert.NoError(t, spool.Close())
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, ".spool", filepath.Ext(entries[0].Name()))
+}
+
+func TestClientSpoolCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), ReplayInterval: time.Hour})
+	assert.NoError(t, err)
+	defer spool.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+		Spool:       spool,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.ErrorIs(t, client.PageViewContext(ctx, req, nil), context.Canceled)
+	assert.Equal(t, int64(0), spool.Size())
+	assert.False(t, isTransientError(context.Canceled))
+	assert.False(t, isTransientError(errors.New("json: unsupported value")))
+}
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	lockFileRetryInterval = time.Millisecond * 10
+	lockFileStaleAfter    = time.Second * 30
+)
+
+// Token is an access token for the Pirsch API.
+type Token struct {
+	// AccessToken is the token sent in the Authorization header.
+	AccessToken string `json:"access_token"`
+
+	// ExpiresAt is the time the token expires. A zero time means the token never expires.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Valid returns whether the token is set and won't expire within given duration.
+func (token *Token) Valid(margin time.Duration) bool {
+	return token != nil && token.AccessToken != "" && (token.ExpiresAt.IsZero() || time.Until(token.ExpiresAt) > margin)
+}
+
+// TokenSource provides access tokens to the Client.
+// The Client caches the token in memory and calls the TokenSource again shortly before it expires,
+// or if the API rejects it. TokenSources caching tokens themselves can implement an
+// InvalidateToken(accessToken string) error method to remove tokens that have been rejected.
+type TokenSource interface {
+	// Token returns a new access token.
+	Token(ctx context.Context) (*Token, error)
+}
+
+// tokenInvalidator is implemented by TokenSources caching tokens.
+type tokenInvalidator interface {
+	InvalidateToken(accessToken string) error
+}
+
+// StaticTokenSource is a TokenSource for single access tokens, which never expire.
+type StaticTokenSource struct {
+	// AccessToken is the single access token.
+	AccessToken string
+}
+
+// Token implements the TokenSource interface.
+func (source *StaticTokenSource) Token(context.Context) (*Token, error) {
+	return &Token{AccessToken: source.AccessToken}, nil
+}
+
+// ClientCredentialsTokenSource is a TokenSource requesting access tokens using a client ID and secret.
+type ClientCredentialsTokenSource struct {
+	// ClientID is the client ID as generated on the Pirsch dashboard.
+	ClientID string
+
+	// ClientSecret is the client secret as generated on the Pirsch dashboard.
+	ClientSecret string
+
+	// BaseURL is optional and can be used to configure a different host for the API.
+	BaseURL string
+
+	// HTTPClient is an optional http.Client used to request tokens.
+	HTTPClient *http.Client
+}
+
+// Token implements the TokenSource interface.
+func (source *ClientCredentialsTokenSource) Token(ctx context.Context) (*Token, error) {
+	body := struct {
+		ClientId     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}{
+		source.ClientID,
+		source.ClientSecret,
+	}
+	bodyJson, err := json.Marshal(&body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := source.BaseURL
+
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+authenticationEndpoint, bytes.NewBuffer(bodyJson))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	c := source.HTTPClient
+
+	if c == nil {
+		c = &http.Client{Timeout: defaultTimeout}
+	}
+
+	resp, err := c.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(req.Method, req.URL.String(), resp)
+	}
+
+	token := new(Token)
+	decoder := json.NewDecoder(resp.Body)
+
+	if err := decoder.Decode(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// FileTokenCache is a TokenSource caching tokens from another TokenSource in a file.
+// The file is shared between processes and guarded by a lock file, so that short-lived processes can reuse unexpired tokens.
+type FileTokenCache struct {
+	path   string
+	source TokenSource
+}
+
+// NewFileTokenCache creates a new FileTokenCache storing tokens from given source at given path.
+// The lock file is created next to it, using the same path with a .lock suffix.
+func NewFileTokenCache(path string, source TokenSource) *FileTokenCache {
+	return &FileTokenCache{
+		path:   path,
+		source: source,
+	}
+}
+
+// Token implements the TokenSource interface.
+// It returns the cached token if it won't expire soon, or requests a new one from the source otherwise.
+func (cache *FileTokenCache) Token(ctx context.Context) (*Token, error) {
+	unlock, err := lockFile(ctx, cache.path+".lock")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+	token, err := cache.read()
+
+	if err == nil && token.Valid(tokenRefreshMargin) {
+		return token, nil
+	}
+
+	token, err = cache.source.Token(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.write(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// InvalidateToken removes the cached token if it matches given access token.
+func (cache *FileTokenCache) InvalidateToken(accessToken string) error {
+	unlock, err := lockFile(context.Background(), cache.path+".lock")
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+	token, err := cache.read()
+
+	if err != nil || token.AccessToken != accessToken {
+		return nil
+	}
+
+	if err := os.Remove(cache.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (cache *FileTokenCache) read() (*Token, error) {
+	data, err := os.ReadFile(cache.path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	token := new(Token)
+
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (cache *FileTokenCache) write(token *Token) error {
+	data, err := json.Marshal(token)
+
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that readers never see a partially written token
+	f, err := os.CreateTemp(filepath.Dir(cache.path), filepath.Base(cache.path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), cache.path)
+}
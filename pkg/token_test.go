@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileTokenCache(t *testing.T) {
+	var tokenRequests atomic.Int32
+	source := tokenSourceFunc(func(context.Context) (*Token, error) {
+		tokenRequests.Add(1)
+		return &Token{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	})
+	path := filepath.Join(t.TempDir(), "token.json")
+	var wg sync.WaitGroup
+
+	// simulate multiple processes sharing the same file
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			token, err := NewFileTokenCache(path, source).Token(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "token", token.AccessToken)
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(1), tokenRequests.Load())
+	cache := NewFileTokenCache(path, source)
+	assert.NoError(t, cache.InvalidateToken("other"))
+	_, err := cache.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), tokenRequests.Load())
+	assert.NoError(t, cache.InvalidateToken("token"))
+	_, err = cache.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), tokenRequests.Load())
+}
+
+func TestClientTokenSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	client := NewClient("", "", &ClientConfig{
+		BaseURL:     server.URL,
+		TokenSource: &StaticTokenSource{AccessToken: "valid"},
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.NoError(t, client.PageView(req, nil))
+	client = NewClient("", "invalid", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	assert.ErrorIs(t, client.PageView(req, nil), ErrUnauthorized)
+	client = NewClient("", "", &ClientConfig{
+		BaseURL:     server.URL,
+		RetryPolicy: &DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+		TokenSource: tokenSourceFunc(func(context.Context) (*Token, error) {
+			return nil, errors.New("error")
+		}),
+	})
+	assert.EqualError(t, client.PageView(req, nil), "error refreshing token (attempt 2): error")
+}
+
+type tokenSourceFunc func(context.Context) (*Token, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
@@ -0,0 +1,489 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTrackerWorkers       = 1
+	defaultTrackerQueueSize     = 1000
+	defaultTrackerBatchSize     = 50
+	defaultTrackerFlushInterval = time.Second * 5
+)
+
+// OverflowPolicy decides what happens if data is submitted to the AsyncTracker while its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest rejects the new data and returns ErrQueueFull.
+	OverflowDropNewest OverflowPolicy = iota
+
+	// OverflowDropOldest removes the oldest data from the queue to make room for the new data.
+	OverflowDropOldest
+
+	// OverflowBlock blocks until there is room in the queue, the AsyncTracker is closed, or the request context is canceled.
+	OverflowBlock
+)
+
+// AsyncTrackerConfig is used to configure the AsyncTracker.
+type AsyncTrackerConfig struct {
+	// Workers is the number of goroutines sending batches to Pirsch. 1 by default.
+	Workers int
+
+	// QueueSize is the maximum number of page views, events, and sessions waiting to be sent. 1000 by default.
+	QueueSize int
+
+	// BatchSize is the maximum number of page views, events, and sessions collected by a worker before they are sent.
+	// Each kind is sent in a separate request. 50 by default.
+	BatchSize int
+
+	// FlushInterval is the maximum time data waits in the queue before it is sent. 5 seconds by default.
+	FlushInterval time.Duration
+
+	// Overflow decides what happens if the queue is full. OverflowDropNewest by default.
+	Overflow OverflowPolicy
+
+	// OnError is called with the error and affected data if a batch could not be sent or data has been dropped.
+	// Errors are logged using the client logger if not set.
+	OnError func(err error, batch *Batch)
+}
+
+// AsyncTracker sends page views, events, and session keep-alives to Pirsch in the background.
+// The data is collected in a bounded in-memory queue and sent in batches once the batch size or flush interval is reached,
+// so that tracking doesn't add latency to the request path.
+type AsyncTracker struct {
+	client        *Client
+	queue         chan trackerItem
+	flush         []chan *flushRequest
+	done          chan struct{}
+	workers       int
+	batchSize     int
+	flushInterval time.Duration
+	overflow      OverflowPolicy
+	onError       func(error, *Batch)
+	dropped       atomic.Uint64
+	failed        atomic.Uint64
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+	senders       sync.WaitGroup
+	err           error
+	closed        bool
+	m             sync.RWMutex
+}
+
+// NewAsyncTracker creates a new AsyncTracker for given Client and optional configuration and starts its workers.
+// Make sure to call Close on the AsyncTracker or Client before the program exits to send the remaining data.
+// If the Client has been closed already, the AsyncTracker is closed as well and rejects all data with ErrClosed.
+func NewAsyncTracker(client *Client, config *AsyncTrackerConfig) *AsyncTracker {
+	if config == nil {
+		config = new(AsyncTrackerConfig)
+	}
+
+	if config.Workers <= 0 {
+		config.Workers = defaultTrackerWorkers
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultTrackerQueueSize
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultTrackerBatchSize
+	}
+
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultTrackerFlushInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker := &AsyncTracker{
+		client:        client,
+		queue:         make(chan trackerItem, config.QueueSize),
+		flush:         make([]chan *flushRequest, config.Workers),
+		done:          make(chan struct{}),
+		workers:       config.Workers,
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval,
+		overflow:      config.Overflow,
+		onError:       config.OnError,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+
+	// trackers created after the client has been closed reject all data and don't start any workers
+	if !client.addTracker(tracker) {
+		tracker.closed = true
+		close(tracker.done)
+		close(tracker.queue)
+		cancel()
+		return tracker
+	}
+
+	tracker.wg.Add(config.Workers)
+
+	for i := 0; i < config.Workers; i++ {
+		tracker.flush[i] = make(chan *flushRequest)
+		go tracker.work(tracker.flush[i])
+	}
+
+	return tracker
+}
+
+// PageView queues a page hit for given http.Request and options.
+// The page view data is read from the request immediately, so the request can be reused once this function returns.
+func (tracker *AsyncTracker) PageView(r *http.Request, options *PageViewOptions) error {
+	if options == nil {
+		options = new(PageViewOptions)
+	}
+
+	hit := tracker.client.getPageViewData(r, options)
+
+	if err := tracker.client.filterBot(&hit); err != nil {
+		return err
+	}
+
+	if err := tracker.client.handleSpeculativeLoad(r, &hit); err != nil {
+		return err
+	}
+
+	if err := tracker.client.handlePartialRequest(r); err != nil {
+		return err
+	}
+
+	return tracker.enqueue(r.Context(), trackerItem{
+		pageView: &BatchPageView{
+			PageView: hit,
+			Time:     time.Now().UTC(),
+		},
+	})
+}
+
+// Event queues an event for given http.Request and options.
+// The event data is read from the request immediately, so the request can be reused once this function returns.
+func (tracker *AsyncTracker) Event(name string, durationSeconds int, meta map[string]string, r *http.Request, options *PageViewOptions) error {
+	if options == nil {
+		options = new(PageViewOptions)
+	}
+
+	event := tracker.client.getEventData(name, durationSeconds, meta, r, options)
+
+	if err := tracker.client.filterBot(&event.PageView); err != nil {
+		return err
+	}
+
+	return tracker.enqueue(r.Context(), trackerItem{
+		event: &BatchEvent{
+			Event: event,
+			Time:  time.Now().UTC(),
+		},
+	})
+}
+
+// Session queues a session keep-alive for given http.Request and options.
+// The session data is read from the request immediately, so the request can be reused once this function returns.
+func (tracker *AsyncTracker) Session(r *http.Request, options *PageViewOptions) error {
+	if options == nil {
+		options = new(PageViewOptions)
+	}
+
+	return tracker.enqueue(r.Context(), trackerItem{
+		session: &BatchPageView{
+			PageView: tracker.client.getSessionData(r, options),
+			Time:     time.Now().UTC(),
+		},
+	})
+}
+
+// Flush sends the data queued before calling it and waits until it has been sent or the context is canceled.
+// Data submitted while flushing is sent as usual and not waited for.
+func (tracker *AsyncTracker) Flush(ctx context.Context) error {
+	request := &flushRequest{
+		done: make(chan struct{}, tracker.workers),
+	}
+	request.remaining.Store(int64(len(tracker.queue)))
+
+	for _, flush := range tracker.flush {
+		select {
+		case flush <- request:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tracker.ctx.Done():
+			// the workers have stopped and Close has sent the remaining data
+			return nil
+		}
+	}
+
+	for i := 0; i < tracker.workers; i++ {
+		select {
+		case <-request.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tracker.ctx.Done():
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Close stops accepting new data, sends the queued data, and stops the workers.
+// Data still queued or in flight is dropped if the context is canceled before it has been sent.
+// A *DroppedError reporting the number of items that could not be sent while closing is returned in that case,
+// or if the API failed to accept them.
+// Data that could not be sent is written to the spool if the Client has been configured to use one.
+func (tracker *AsyncTracker) Close(ctx context.Context) error {
+	tracker.m.Lock()
+
+	if tracker.closed {
+		tracker.m.Unlock()
+		return nil
+	}
+
+	tracker.closed = true
+	close(tracker.done)
+	tracker.m.Unlock()
+
+	// blocked senders return ErrClosed once done is closed, so the queue can be closed safely afterwards
+	tracker.senders.Wait()
+	close(tracker.queue)
+	defer tracker.client.removeTracker(tracker)
+	failed := tracker.failed.Load()
+	done := make(chan struct{})
+
+	go func() {
+		tracker.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		tracker.cancel()
+		return tracker.droppedError(failed, nil)
+	case <-ctx.Done():
+		// abort requests in flight, the workers drop the remaining data
+		tracker.cancel()
+		<-done
+		return tracker.droppedError(failed, ctx.Err())
+	}
+}
+
+// Dropped returns the number of page views, events, and sessions that have been dropped because the queue was full
+// or the request context was canceled while waiting for room in the queue.
+func (tracker *AsyncTracker) Dropped() uint64 {
+	return tracker.dropped.Load()
+}
+
+// droppedError returns a *DroppedError if data failed to be sent since the failed counter was read, or nil otherwise.
+// The context error is reported if set, or the last error sending data otherwise.
+func (tracker *AsyncTracker) droppedError(failed uint64, ctxErr error) error {
+	dropped := tracker.failed.Load() - failed
+
+	if dropped == 0 {
+		return nil
+	}
+
+	err := ctxErr
+
+	if err == nil {
+		tracker.m.RLock()
+		err = tracker.err
+		tracker.m.RUnlock()
+	}
+
+	return &DroppedError{
+		Dropped: int(dropped),
+		Err:     err,
+	}
+}
+
+func (tracker *AsyncTracker) enqueue(ctx context.Context, item trackerItem) error {
+	batch := new(Batch)
+	item.addTo(batch)
+
+	if err := batch.validate(); err != nil {
+		return err
+	}
+
+	tracker.m.RLock()
+
+	if tracker.closed || tracker.client.closed.Load() {
+		tracker.m.RUnlock()
+		return ErrClosed
+	}
+
+	tracker.senders.Add(1)
+	tracker.m.RUnlock()
+	defer tracker.senders.Done()
+
+	switch tracker.overflow {
+	case OverflowBlock:
+		select {
+		case tracker.queue <- item:
+			return nil
+		case <-tracker.done:
+			return ErrClosed
+		case <-ctx.Done():
+			tracker.dropped.Add(1)
+			return ctx.Err()
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case tracker.queue <- item:
+				return nil
+			default:
+			}
+
+			select {
+			case oldest := <-tracker.queue:
+				tracker.drop(oldest)
+			default:
+			}
+		}
+	default:
+		select {
+		case tracker.queue <- item:
+			return nil
+		default:
+			tracker.dropped.Add(1)
+			return ErrQueueFull
+		}
+	}
+}
+
+func (tracker *AsyncTracker) drop(item trackerItem) {
+	tracker.dropped.Add(1)
+	batch := new(Batch)
+	item.addTo(batch)
+	tracker.handleError(ErrQueueFull, batch)
+}
+
+func (tracker *AsyncTracker) work(flush <-chan *flushRequest) {
+	defer tracker.wg.Done()
+	ticker := time.NewTicker(tracker.flushInterval)
+	defer ticker.Stop()
+	batch := new(Batch)
+
+	for {
+		select {
+		case item, ok := <-tracker.queue:
+			if !ok {
+				tracker.send(batch)
+				return
+			}
+
+			item.addTo(batch)
+
+			if batch.Len() >= tracker.batchSize {
+				tracker.send(batch)
+				batch = new(Batch)
+			}
+		case <-ticker.C:
+			if batch.Len() > 0 {
+				tracker.send(batch)
+				batch = new(Batch)
+			}
+		case request := <-flush:
+			batch = tracker.drain(request, batch)
+
+			if batch.Len() > 0 {
+				tracker.send(batch)
+				batch = new(Batch)
+			}
+
+			request.done <- struct{}{}
+		}
+	}
+}
+
+// drain takes up to the number of items remaining for the flush request from the queue and adds them to the batch.
+// Full batches are sent right away. All items queued before the request have been taken from the queue once it returns,
+// either by this worker or by others that haven't handled the request yet.
+func (tracker *AsyncTracker) drain(request *flushRequest, batch *Batch) *Batch {
+	for request.remaining.Add(-1) >= 0 {
+		select {
+		case item, ok := <-tracker.queue:
+			if !ok {
+				return batch
+			}
+
+			item.addTo(batch)
+
+			if batch.Len() >= tracker.batchSize {
+				tracker.send(batch)
+				batch = new(Batch)
+			}
+		default:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+func (tracker *AsyncTracker) send(batch *Batch) {
+	client := tracker.client
+
+	if len(batch.PageViews) > 0 {
+		part := &Batch{PageViews: batch.PageViews}
+		tracker.sendPart(part, client.postTrackingData(tracker.ctx, client.baseURL+hitBatchEndpoint, part.PageViews, part))
+	}
+
+	if len(batch.Events) > 0 {
+		part := &Batch{Events: batch.Events}
+		tracker.sendPart(part, client.postTrackingData(tracker.ctx, client.baseURL+eventBatchEndpoint, part.Events, part))
+	}
+
+	if len(batch.Sessions) > 0 {
+		part := &Batch{Sessions: batch.Sessions}
+		tracker.sendPart(part, client.postTrackingData(tracker.ctx, client.baseURL+sessionBatchEndpoint, part.Sessions, part))
+	}
+}
+
+func (tracker *AsyncTracker) sendPart(part *Batch, err error) {
+	if err != nil {
+		tracker.m.Lock()
+		tracker.err = err
+		tracker.m.Unlock()
+		tracker.failed.Add(uint64(part.Len()))
+		tracker.handleError(err, part)
+	}
+}
+
+func (tracker *AsyncTracker) handleError(err error, batch *Batch) {
+	if tracker.onError != nil {
+		tracker.onError(err, batch)
+	} else if tracker.client.logger != nil {
+		tracker.client.logger.Error("error sending batch", "err", err, "page_views", len(batch.PageViews), "events", len(batch.Events), "sessions", len(batch.Sessions))
+	}
+}
+
+// flushRequest is sent to all workers by Flush.
+// The number of remaining items is the length of the queue when Flush has been called.
+type flushRequest struct {
+	remaining atomic.Int64
+	done      chan struct{}
+}
+
+// trackerItem is a page view, event, or session keep-alive queued by the AsyncTracker.
+// Exactly one of the fields is set.
+type trackerItem struct {
+	pageView *BatchPageView
+	event    *BatchEvent
+	session  *BatchPageView
+}
+
+func (item trackerItem) addTo(batch *Batch) {
+	if item.pageView != nil {
+		batch.PageViews = append(batch.PageViews, *item.pageView)
+	} else if item.event != nil {
+		batch.Events = append(batch.Events, *item.event)
+	} else if item.session != nil {
+		batch.Sessions = append(batch.Sessions, *item.session)
+	}
+}
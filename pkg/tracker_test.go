@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncTracker(t *testing.T) {
+	var m sync.Mutex
+	var batches [][]BatchPageView
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, hitBatchEndpoint, r.URL.Path)
+		var views []BatchPageView
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&views))
+		m.Lock()
+		batches = append(batches, views)
+		m.Unlock()
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	tracker := NewAsyncTracker(client, &AsyncTrackerConfig{
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+	})
+
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, tracker.PageView(httptest.NewRequest(http.MethodGet, "https://example.com/", nil), &PageViewOptions{
+			Title: "Title",
+		}))
+	}
+
+	assert.NoError(t, tracker.Flush(context.Background()))
+	m.Lock()
+	n := 0
+
+	for _, batch := range batches {
+		assert.LessOrEqual(t, len(batch), 3)
+		n += len(batch)
+	}
+
+	assert.Equal(t, 7, n)
+	assert.Equal(t, "https://example.com/", batches[0][0].URL)
+	assert.Equal(t, "Title", batches[0][0].Title)
+	assert.False(t, batches[0][0].Time.IsZero())
+	m.Unlock()
+	assert.NoError(t, tracker.Close(context.Background()))
+	assert.ErrorIs(t, tracker.PageView(httptest.NewRequest(http.MethodGet, "https://example.com/", nil), nil), ErrClosed)
+}
+
+func TestAsyncTrackerOverflow(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	var m sync.Mutex
+	var dropped []BatchPageView
+	tracker := NewAsyncTracker(client, &AsyncTrackerConfig{
+		QueueSize: 2,
+		BatchSize: 1,
+		Overflow:  OverflowDropOldest,
+		OnError: func(err error, batch *Batch) {
+			assert.ErrorIs(t, err, ErrQueueFull)
+			m.Lock()
+			dropped = append(dropped, batch.PageViews...)
+			m.Unlock()
+		},
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+	// the first page view is in flight, the following ones fill the queue
+	assert.NoError(t, tracker.PageView(req, &PageViewOptions{Title: "0"}))
+	time.Sleep(time.Millisecond * 50)
+
+	for i := 1; i < 5; i++ {
+		assert.NoError(t, tracker.PageView(req, &PageViewOptions{Title: string(rune('0' + i))}))
+	}
+
+	assert.Equal(t, uint64(2), tracker.Dropped())
+	m.Lock()
+	assert.Len(t, dropped, 2)
+	assert.Equal(t, "1", dropped[0].Title)
+	assert.Equal(t, "2", dropped[1].Title)
+	m.Unlock()
+	close(block)
+	assert.NoError(t, tracker.Close(context.Background()))
+}
+
+func TestAsyncTrackerEventsAndSessions(t *testing.T) {
+	var m sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data []map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&data))
+
+		for _, d := range data {
+			assert.NotEmpty(t, d["time"])
+		}
+
+		m.Lock()
+		requests[r.URL.Path] += len(data)
+		m.Unlock()
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	tracker := NewAsyncTracker(client, &AsyncTrackerConfig{
+		Workers:       2,
+		FlushInterval: time.Millisecond * 10,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.NoError(t, tracker.PageView(req, nil))
+	assert.NoError(t, tracker.Event("event", 0, map[string]string{"key": "value"}, req, nil))
+	assert.NoError(t, tracker.Event("event", 0, nil, req, nil))
+	assert.NoError(t, tracker.Session(req, nil))
+	assert.NoError(t, tracker.Close(context.Background()))
+	assert.Equal(t, map[string]int{
+		hitBatchEndpoint:     1,
+		eventBatchEndpoint:   2,
+		sessionBatchEndpoint: 1,
+	}, requests)
+}
+
+func TestAsyncTrackerFlushUnderLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	tracker := NewAsyncTracker(client, &AsyncTrackerConfig{
+		Workers:       2,
+		BatchSize:     5,
+		FlushInterval: time.Hour,
+	})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = tracker.PageView(req, nil)
+				time.Sleep(time.Microsecond * 200)
+			}
+		}
+	}()
+
+	time.Sleep(time.Millisecond * 50)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	assert.NoError(t, tracker.Flush(ctx))
+	close(stop)
+	<-done
+	assert.NoError(t, tracker.Close(context.Background()))
+}
+
+func TestAsyncTrackerOverflowBlock(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	tracker := NewAsyncTracker(client, &AsyncTrackerConfig{
+		QueueSize: 1,
+		BatchSize: 1,
+		Overflow:  OverflowBlock,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+	// the first page view is in flight, the second one fills the queue
+	assert.NoError(t, tracker.PageView(req, nil))
+	time.Sleep(time.Millisecond * 50)
+	assert.NoError(t, tracker.PageView(req, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	assert.ErrorIs(t, tracker.PageView(req.WithContext(ctx), nil), context.DeadlineExceeded)
+	assert.Equal(t, uint64(1), tracker.Dropped())
+	blocked := make(chan error)
+
+	go func() {
+		blocked <- tracker.PageView(req, nil)
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer closeCancel()
+	var droppedErr *DroppedError
+	assert.ErrorAs(t, tracker.Close(closeCtx), &droppedErr)
+	assert.ErrorIs(t, <-blocked, ErrClosed)
+	close(block)
+}
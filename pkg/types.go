@@ -53,6 +53,12 @@ type PageView struct {
 	Tags                   map[string]string `json:"tags"`
 }
 
+// BatchPageView is a page view including the time it occurred, used to send page views in batches.
+type BatchPageView struct {
+	PageView
+	Time time.Time `json:"time"`
+}
+
 // Event represents a single data point for custom events.
 // It's basically the same as PageView, but with some additional fields (event name, time, and meta fields).
 type Event struct {
@@ -62,6 +68,24 @@ type Event struct {
 	Metadata        map[string]string `json:"event_meta"`
 }
 
+// BatchEvent is an event including the time it occurred, used to send events in batches.
+type BatchEvent struct {
+	Event
+	Time time.Time `json:"time"`
+}
+
+// Batch is a set of page views, events, and session keep-alives sent together.
+type Batch struct {
+	PageViews []BatchPageView
+	Events    []BatchEvent
+	Sessions  []BatchPageView
+}
+
+// Len returns the total number of page views, events, and sessions in the batch.
+func (batch *Batch) Len() int {
+	return len(batch.PageViews) + len(batch.Events) + len(batch.Sessions)
+}
+
 // Filter is used to filter statistics.
 // DomainID, From, and To are required dates (the time is ignored).
 type Filter struct {
@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"unicode/utf8"
+)
+
+const (
+	// MaxURLLength is the maximum length of page URLs and referrers.
+	MaxURLLength = 2048
+
+	// MaxTitleLength is the maximum length of page titles.
+	MaxTitleLength = 512
+
+	// MaxTags is the maximum number of tags per page view or event.
+	MaxTags = 20
+
+	// MaxEventNameLength is the maximum length of event names.
+	MaxEventNameLength = 200
+
+	// MaxEventMeta is the maximum number of metadata fields per event.
+	MaxEventMeta = 20
+
+	// MaxKeyLength is the maximum length of tag and metadata keys.
+	MaxKeyLength = 200
+
+	// MaxValueLength is the maximum length of tag and metadata values.
+	MaxValueLength = 200
+)
+
+// TruncateValue shortens given tag or metadata value to MaxValueLength characters, so that it passes validation.
+func TruncateValue(value string) string {
+	if utf8.RuneCountInString(value) <= MaxValueLength {
+		return value
+	}
+
+	return string([]rune(value)[:MaxValueLength])
+}
+
+// Validate checks the page view before it is sent and returns a *ValidationError listing all invalid fields.
+// The URL must be absolute and the IP valid.
+func (pageView *PageView) Validate() error {
+	err := new(ValidationError)
+
+	if pageView.URL == "" {
+		err.add("url", "required")
+	} else if utf8.RuneCountInString(pageView.URL) > MaxURLLength {
+		err.add("url", fmt.Sprintf("must not be longer than %d characters", MaxURLLength))
+	} else if u, parseErr := url.Parse(pageView.URL); parseErr != nil || !u.IsAbs() || u.Host == "" {
+		err.add("url", "must be an absolute URL")
+	}
+
+	if pageView.IP == "" {
+		err.add("ip", "required")
+	} else if _, parseErr := netip.ParseAddr(pageView.IP); parseErr != nil {
+		err.add("ip", "must be a valid IP address")
+	}
+
+	if utf8.RuneCountInString(pageView.Referrer) > MaxURLLength {
+		err.add("referrer", fmt.Sprintf("must not be longer than %d characters", MaxURLLength))
+	}
+
+	if utf8.RuneCountInString(pageView.Title) > MaxTitleLength {
+		err.add("title", fmt.Sprintf("must not be longer than %d characters", MaxTitleLength))
+	}
+
+	if pageView.ScreenWidth < 0 {
+		err.add("screen_width", "must not be negative")
+	}
+
+	if pageView.ScreenHeight < 0 {
+		err.add("screen_height", "must not be negative")
+	}
+
+	validateKeyValues(err, "tags", pageView.Tags, MaxTags)
+	return err.errorOrNil()
+}
+
+// Validate checks the event before it is sent and returns a *ValidationError listing all invalid fields.
+// This includes the fields of the PageView.
+func (event *Event) Validate() error {
+	err := new(ValidationError)
+	err.merge("", event.PageView.Validate())
+
+	if event.Name == "" {
+		err.add("event_name", "required")
+	} else if utf8.RuneCountInString(event.Name) > MaxEventNameLength {
+		err.add("event_name", fmt.Sprintf("must not be longer than %d characters", MaxEventNameLength))
+	}
+
+	if event.DurationSeconds < 0 {
+		err.add("event_duration", "must not be negative")
+	}
+
+	validateKeyValues(err, "event_meta", event.Metadata, MaxEventMeta)
+	return err.errorOrNil()
+}
+
+// Validate checks the filter before it is sent and returns a *ValidationError listing all invalid fields.
+// The date range is not required, as not all endpoints use it (e.g. ActiveVisitors), and is left to the API.
+func (filter *Filter) Validate() error {
+	err := new(ValidationError)
+
+	if filter.DomainID == "" {
+		err.add("id", "required")
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		err.add("to", "must not be before from")
+	}
+
+	if filter.Start < 0 {
+		err.add("start", "must not be negative")
+	}
+
+	if filter.Offset < 0 {
+		err.add("offset", "must not be negative")
+	}
+
+	if filter.Limit < 0 {
+		err.add("limit", "must not be negative")
+	}
+
+	if filter.Direction != "" && filter.Direction != "asc" && filter.Direction != "desc" {
+		err.add("direction", "must be asc or desc")
+	}
+
+	if filter.CustomMetricType != "" && filter.CustomMetricType != CustomMetricTypeInteger && filter.CustomMetricType != CustomMetricTypeFloat {
+		err.add("custom_metric_type", "must be integer or float")
+	}
+
+	if (filter.CustomMetricKey == "") != (filter.CustomMetricType == "") {
+		err.add("custom_metric_key", "must be set together with custom_metric_type")
+	}
+
+	return err.errorOrNil()
+}
+
+// validate checks all page views, events, and sessions in the batch.
+// Fields are prefixed with the kind and index if the batch contains more than one item.
+func (batch *Batch) validate() error {
+	err := new(ValidationError)
+	prefix := func(kind string, i int) string {
+		if batch.Len() == 1 {
+			return ""
+		}
+
+		return fmt.Sprintf("%s[%d].", kind, i)
+	}
+
+	for i := range batch.PageViews {
+		err.merge(prefix("page_views", i), batch.PageViews[i].Validate())
+	}
+
+	for i := range batch.Events {
+		err.merge(prefix("events", i), batch.Events[i].Validate())
+	}
+
+	for i := range batch.Sessions {
+		err.merge(prefix("sessions", i), batch.Sessions[i].Validate())
+	}
+
+	return err.errorOrNil()
+}
+
+func validateKeyValues(err *ValidationError, field string, values map[string]string, max int) {
+	if len(values) > max {
+		err.add(field, fmt.Sprintf("must not contain more than %d entries", max))
+	}
+
+	for k, v := range values {
+		if k == "" {
+			err.add(field, "keys must not be empty")
+		} else if utf8.RuneCountInString(k) > MaxKeyLength {
+			err.add(field, fmt.Sprintf("keys must not be longer than %d characters", MaxKeyLength))
+		} else if utf8.RuneCountInString(v) > MaxValueLength {
+			err.add(field+"."+k, fmt.Sprintf("must not be longer than %d characters", MaxValueLength))
+		}
+	}
+}
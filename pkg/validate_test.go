@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPageViewValidate(t *testing.T) {
+	pageView := &PageView{
+		URL: "https://example.com/",
+		IP:  "198.51.100.1",
+	}
+	assert.NoError(t, pageView.Validate())
+	tags := make(map[string]string)
+
+	for i := 0; i <= MaxTags; i++ {
+		tags[strings.Repeat("k", i+1)] = "v"
+	}
+
+	pageView = &PageView{
+		URL:         "/relative",
+		IP:          "invalid",
+		Title:       strings.Repeat("t", MaxTitleLength+1),
+		ScreenWidth: -1,
+		Tags:        tags,
+	}
+	err := pageView.Validate()
+	var validationErr *ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, map[string]string{
+		"url":          "must be an absolute URL",
+		"ip":           "must be a valid IP address",
+		"title":        "must not be longer than 512 characters",
+		"screen_width": "must not be negative",
+		"tags":         "must not contain more than 20 entries",
+	}, validationErr.Fields)
+	assert.Equal(t, "validation failed: ip: must be a valid IP address, screen_width: must not be negative, tags: must not contain more than 20 entries, title: must not be longer than 512 characters, url: must be an absolute URL", err.Error())
+	assert.False(t, isTransientError(err))
+}
+
+func TestEventValidate(t *testing.T) {
+	event := &Event{
+		PageView: PageView{
+			URL: "https://example.com/",
+			IP:  "2001:db8::1",
+		},
+		Name:     "Signup",
+		Metadata: map[string]string{"plan": "pro"},
+	}
+	assert.NoError(t, event.Validate())
+	event.Name = ""
+	event.DurationSeconds = -1
+	event.Metadata["plan"] = strings.Repeat("v", MaxValueLength+1)
+	event.URL = ""
+	var validationErr *ValidationError
+	assert.True(t, errors.As(event.Validate(), &validationErr))
+	assert.Equal(t, map[string]string{
+		"url":             "required",
+		"event_name":      "required",
+		"event_duration":  "must not be negative",
+		"event_meta.plan": "must not be longer than 200 characters",
+	}, validationErr.Fields)
+}
+
+func TestTruncateValue(t *testing.T) {
+	assert.Equal(t, "value", TruncateValue("value"))
+	assert.Equal(t, strings.Repeat("ä", MaxValueLength), TruncateValue(strings.Repeat("ä", MaxValueLength+1)))
+}
+
+func TestFilterValidate(t *testing.T) {
+	now := time.Now()
+	assert.NoError(t, (&Filter{DomainID: "id", From: now, To: now}).Validate())
+	assert.NoError(t, (&Filter{DomainID: "id"}).Validate())
+	var validationErr *ValidationError
+	assert.True(t, errors.As((&Filter{From: now, To: now.Add(-time.Hour * 24), Limit: -1, Direction: "up", CustomMetricKey: "key"}).Validate(), &validationErr))
+	assert.Equal(t, map[string]string{
+		"id":                "required",
+		"to":                "must not be before from",
+		"limit":             "must not be negative",
+		"direction":         "must be asc or desc",
+		"custom_metric_key": "must be set together with custom_metric_type",
+	}, validationErr.Fields)
+}
+
+func TestClientValidate(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	assert.NoError(t, client.PageView(req, nil))
+	assert.Equal(t, "http://example.com/page", client.getPageViewData(req, new(PageViewOptions)).URL)
+	var validationErr *ValidationError
+	assert.True(t, errors.As(client.Event("", 0, nil, req, nil), &validationErr))
+	assert.Equal(t, "required", validationErr.Fields["event_name"])
+	err := client.PageViewBatch([]BatchPageView{
+		{PageView: PageView{URL: "https://example.com/", IP: "198.51.100.1"}},
+		{PageView: PageView{URL: "https://example.com/"}},
+	})
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, map[string]string{"page_views[1].ip": "required"}, validationErr.Fields)
+	_, err = client.VisitorsContext(context.Background(), &Filter{From: time.Now()})
+	assert.True(t, errors.As(err, &validationErr))
+	tracker := NewAsyncTracker(client, nil)
+	assert.True(t, errors.As(tracker.Event("", 0, nil, req, nil), &validationErr))
+	assert.NoError(t, tracker.Close(context.Background()))
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrVisitorRequired is returned if the visitor IP or user agent is missing when tracking data without a request.
+var ErrVisitorRequired = errors.New("visitor ip and user agent required")
+
+// VisitorContext identifies a visitor without an http.Request.
+// It can be captured from a request using Client.VisitorContext and stored (e.g. as JSON) to track
+// events for the same visitor later, like from a background job.
+// Pirsch identifies visitors by a hash of their IP and user agent using a daily salt,
+// so data is only attributed to the same visitor and session on the same day (UTC) and before the session timed out.
+type VisitorContext struct {
+	URL                    string `json:"url"`
+	IP                     string `json:"ip"`
+	UserAgent              string `json:"user_agent"`
+	AcceptLanguage         string `json:"accept_language,omitempty"`
+	SecCHUA                string `json:"sec_ch_ua,omitempty"`
+	SecCHUAMobile          string `json:"sec_ch_ua_mobile,omitempty"`
+	SecCHUAPlatform        string `json:"sec_ch_ua_platform,omitempty"`
+	SecCHUAPlatformVersion string `json:"sec_ch_ua_platform_version,omitempty"`
+	SecCHWidth             string `json:"sec_ch_width,omitempty"`
+	SecCHViewportWidth     string `json:"sec_ch_viewport_width,omitempty"`
+	Referrer               string `json:"referrer,omitempty"`
+	ScreenWidth            int    `json:"screen_width,omitempty"`
+	ScreenHeight           int    `json:"screen_height,omitempty"`
+}
+
+// PageViewInput are the parameters to send a page view without an http.Request.
+type PageViewInput struct {
+	// Visitor is the visitor the page view belongs to.
+	Visitor VisitorContext
+
+	// URL is the optional page URL. VisitorContext.URL is used if not set.
+	URL string
+
+	// Title is the optional page title.
+	Title string
+
+	// Tags are optional tags.
+	Tags map[string]string
+
+	// Time is the optional time the page view occurred. The current time is used if not set.
+	Time time.Time
+}
+
+// EventInput are the parameters to send an event without an http.Request.
+type EventInput struct {
+	// Visitor is the visitor the event belongs to.
+	Visitor VisitorContext
+
+	// Name is the event name.
+	Name string
+
+	// DurationSeconds is the optional event duration.
+	DurationSeconds int
+
+	// Meta is the optional event metadata.
+	Meta map[string]string
+
+	// URL is the optional page URL. VisitorContext.URL is used if not set.
+	URL string
+
+	// Title is the optional page title.
+	Title string
+
+	// Tags are optional tags.
+	Tags map[string]string
+
+	// Time is the optional time the event occurred. The current time is used if not set.
+	Time time.Time
+}
+
+// VisitorContext returns the VisitorContext for given http.Request and options.
+// The IP and headers are read from the request the same way as for PageView.
+func (client *Client) VisitorContext(r *http.Request, options *PageViewOptions) *VisitorContext {
+	if options == nil {
+		options = new(PageViewOptions)
+	}
+
+	hit := client.getPageViewData(r, options)
+	return &VisitorContext{
+		URL:                    hit.URL,
+		IP:                     hit.IP,
+		UserAgent:              hit.UserAgent,
+		AcceptLanguage:         hit.AcceptLanguage,
+		SecCHUA:                hit.SecCHUA,
+		SecCHUAMobile:          hit.SecCHUAMobile,
+		SecCHUAPlatform:        hit.SecCHUAPlatform,
+		SecCHUAPlatformVersion: hit.SecCHUAPlatformVersion,
+		SecCHWidth:             hit.SecCHWidth,
+		SecCHViewportWidth:     hit.SecCHViewportWidth,
+		Referrer:               hit.Referrer,
+		ScreenWidth:            hit.ScreenWidth,
+		ScreenHeight:           hit.ScreenHeight,
+	}
+}
+
+// TrackPageView sends a page view to Pirsch for given input.
+// Page views with a Time set are sent using the batch endpoint.
+func (client *Client) TrackPageView(ctx context.Context, input *PageViewInput) error {
+	hit := client.getVisitorPageView(&input.Visitor, input.URL)
+	hit.Title = input.Title
+	hit.Tags = input.Tags
+
+	if err := client.checkVisitor(&hit); err != nil {
+		return err
+	}
+
+	return client.sendPageView(ctx, hit, input.Time)
+}
+
+// TrackEvent sends an event to Pirsch for given input.
+// Events with a Time set are sent using the batch endpoint.
+func (client *Client) TrackEvent(ctx context.Context, input *EventInput) error {
+	hit := client.getVisitorPageView(&input.Visitor, input.URL)
+	hit.Title = input.Title
+	hit.Tags = input.Tags
+
+	if err := client.checkVisitor(&hit); err != nil {
+		return err
+	}
+
+	event := Event{
+		PageView:        hit,
+		Name:            input.Name,
+		DurationSeconds: input.DurationSeconds,
+		Metadata:        input.Meta,
+	}
+	return client.sendEvent(ctx, event, input.Time)
+}
+
+// TrackSession extends the session of given visitor.
+func (client *Client) TrackSession(ctx context.Context, visitor *VisitorContext) error {
+	session := visitor.pageView("")
+
+	if err := client.checkVisitor(&session); err != nil {
+		return err
+	}
+
+	return client.sendSession(ctx, session)
+}
+
+// sendPageView sends the page view using the batch endpoint if the time is set.
+func (client *Client) sendPageView(ctx context.Context, hit PageView, t time.Time) error {
+	views := []BatchPageView{{PageView: hit, Time: trackingTime(t)}}
+	batch := &Batch{PageViews: views}
+
+	if t.IsZero() {
+		return client.performTrackingPost(ctx, client.baseURL+hitEndpoint, &hit, batch)
+	}
+
+	return client.performTrackingPost(ctx, client.baseURL+hitBatchEndpoint, views, batch)
+}
+
+// sendEvent sends the event using the batch endpoint if the time is set.
+func (client *Client) sendEvent(ctx context.Context, event Event, t time.Time) error {
+	events := []BatchEvent{{Event: event, Time: trackingTime(t)}}
+	batch := &Batch{Events: events}
+
+	if t.IsZero() {
+		return client.performTrackingPost(ctx, client.baseURL+eventEndpoint, &event, batch)
+	}
+
+	return client.performTrackingPost(ctx, client.baseURL+eventBatchEndpoint, events, batch)
+}
+
+func (client *Client) sendSession(ctx context.Context, session PageView) error {
+	return client.performTrackingPost(ctx, client.baseURL+sessionEndpoint, &session, &Batch{
+		Sessions: []BatchPageView{{PageView: session, Time: time.Now().UTC()}},
+	})
+}
+
+func (client *Client) checkVisitor(hit *PageView) error {
+	if hit.IP == "" || hit.UserAgent == "" {
+		return ErrVisitorRequired
+	}
+
+	return client.filterBot(hit)
+}
+
+// getVisitorPageView returns the page view for given visitor and optional URL.
+// The URL of the visitor has been normalized already, while an explicit URL is normalized without a request.
+func (client *Client) getVisitorPageView(visitor *VisitorContext, url string) PageView {
+	hit := visitor.pageView(url)
+
+	if url != "" && client.urlNormalizer != nil {
+		hit.URL, _ = client.urlNormalizer.normalize(nil, url)
+	}
+
+	return hit
+}
+
+func (visitor *VisitorContext) pageView(url string) PageView {
+	if url == "" {
+		url = visitor.URL
+	}
+
+	return PageView{
+		URL:                    url,
+		IP:                     visitor.IP,
+		UserAgent:              visitor.UserAgent,
+		AcceptLanguage:         visitor.AcceptLanguage,
+		SecCHUA:                visitor.SecCHUA,
+		SecCHUAMobile:          visitor.SecCHUAMobile,
+		SecCHUAPlatform:        visitor.SecCHUAPlatform,
+		SecCHUAPlatformVersion: visitor.SecCHUAPlatformVersion,
+		SecCHWidth:             visitor.SecCHWidth,
+		SecCHViewportWidth:     visitor.SecCHViewportWidth,
+		Referrer:               visitor.Referrer,
+		ScreenWidth:            visitor.ScreenWidth,
+		ScreenHeight:           visitor.ScreenHeight,
+	}
+}
+
+func trackingTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now().UTC()
+	}
+
+	return t.UTC()
+}
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientTrackEvent(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests <- r
+		bodies <- body
+	}))
+	defer server.Close()
+	client := NewClient("", "secret", &ClientConfig{
+		BaseURL: server.URL,
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/signup", nil)
+	req.RemoteAddr = "198.51.100.1:54321"
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0")
+	req.Header.Set("Accept-Language", "de-DE")
+	req.Header.Set("Sec-CH-UA-Platform", `"Linux"`)
+	req.Header.Set("Referer", "https://google.com")
+	stored, err := json.Marshal(client.VisitorContext(req, nil))
+	assert.NoError(t, err)
+	var visitor VisitorContext
+	assert.NoError(t, json.Unmarshal(stored, &visitor))
+	assert.Equal(t, "https://example.com/signup", visitor.URL)
+	assert.Equal(t, "198.51.100.1", visitor.IP)
+	assert.Equal(t, "de-DE", visitor.AcceptLanguage)
+	assert.Equal(t, `"Linux"`, visitor.SecCHUAPlatform)
+	assert.Equal(t, "https://google.com", visitor.Referrer)
+	assert.NoError(t, client.TrackEvent(context.Background(), &EventInput{
+		Visitor: visitor,
+		Name:    "Invoice Paid",
+		Meta:    map[string]string{"plan": "pro"},
+	}))
+	r := <-requests
+	assert.Equal(t, eventEndpoint, r.URL.Path)
+	var event Event
+	assert.NoError(t, json.Unmarshal(<-bodies, &event))
+	assert.Equal(t, "Invoice Paid", event.Name)
+	assert.Equal(t, "pro", event.Metadata["plan"])
+	assert.Equal(t, "https://example.com/signup", event.URL)
+	assert.Equal(t, "198.51.100.1", event.IP)
+	assert.Equal(t, `"Linux"`, event.SecCHUAPlatform)
+	eventTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	assert.NoError(t, client.TrackEvent(context.Background(), &EventInput{
+		Visitor: visitor,
+		Name:    "Subscription Renewed",
+		URL:     "https://example.com/billing",
+		Time:    eventTime,
+	}))
+	r = <-requests
+	assert.Equal(t, eventBatchEndpoint, r.URL.Path)
+	var events []BatchEvent
+	assert.NoError(t, json.Unmarshal(<-bodies, &events))
+	assert.Len(t, events, 1)
+	assert.Equal(t, "https://example.com/billing", events[0].URL)
+	assert.True(t, eventTime.Equal(events[0].Time))
+	assert.NoError(t, client.TrackPageView(context.Background(), &PageViewInput{
+		Visitor: visitor,
+		Title:   "Signup",
+	}))
+	r = <-requests
+	assert.Equal(t, hitEndpoint, r.URL.Path)
+	var hit PageView
+	assert.NoError(t, json.Unmarshal(<-bodies, &hit))
+	assert.Equal(t, "Signup", hit.Title)
+	assert.NoError(t, client.TrackSession(context.Background(), &visitor))
+	r = <-requests
+	assert.Equal(t, sessionEndpoint, r.URL.Path)
+	<-bodies
+	assert.ErrorIs(t, client.TrackEvent(context.Background(), &EventInput{Name: "event"}), ErrVisitorRequired)
+	var validationErr *ValidationError
+	assert.ErrorAs(t, client.TrackEvent(context.Background(), &EventInput{Visitor: visitor}), &validationErr)
+	assert.Equal(t, "required", validationErr.Fields["event_name"])
+	assert.Empty(t, requests)
+}